@@ -0,0 +1,52 @@
+package autoresize
+
+import (
+	"log/slog"
+	"time"
+)
+
+// adaptiveState grows the increment for resizes following each other within
+// the adaptive reset duration, and shrinks it back once usage stayed under
+// the trigger for that long.
+type adaptiveState struct {
+	// factor multiplies the increment, it is doubled on rapid resizes.
+	factor uint64
+	// calmSince is when usage went under the trigger, zero while over it.
+	calmSince time.Time
+}
+
+// incrementFor returns the increment to use instead of step, capped to the
+// increment cap.
+func (a *adaptiveState) incrementFor(step uint64, opts *Settings) uint64 {
+	factor := max(a.factor, 1)
+	return min(step*factor, max(opts.IncrementCap, step))
+}
+
+// beforeResize doubles the increment when the last resize happened within the
+// adaptive reset duration, and returns the increment to use instead of step.
+func (a *adaptiveState) beforeResize(logger *slog.Logger, step uint64, opts *Settings, now time.Time, lastResize *time.Time) uint64 {
+	a.calmSince = time.Time{}
+	current := a.incrementFor(step, opts)
+	if lastResize != nil && now.Sub(*lastResize) < opts.AdaptiveReset && current < max(opts.IncrementCap, step) {
+		a.factor = max(a.factor, 1) * 2
+		logger.Info(
+			"rapid resizes, growing the increment",
+			slog.String("increment", HumanSize(a.incrementFor(step, opts))),
+			slog.String("previous_increment", HumanSize(current)),
+			slog.String("increment_cap", HumanSize(opts.IncrementCap)),
+		)
+	}
+	return a.incrementFor(step, opts)
+}
+
+// calm resets the increment once usage stayed under the trigger for the
+// adaptive reset duration.
+func (a *adaptiveState) calm(logger *slog.Logger, now time.Time, opts *Settings) {
+	if a.calmSince.IsZero() {
+		a.calmSince = now
+	}
+	if a.factor > 1 && now.Sub(a.calmSince) >= opts.AdaptiveReset {
+		a.factor = 1
+		logger.Info("usage stabilized, resetting the increment", slog.Duration("stable_for", now.Sub(a.calmSince)))
+	}
+}
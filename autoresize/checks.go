@@ -0,0 +1,38 @@
+package autoresize
+
+import (
+	"fmt"
+
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+)
+
+// checkVolumeType returns an error if the instance volume cannot be resized.
+func checkVolumeType(instance *rdb.Instance, opts *Settings) error {
+	switch instance.Volume.Type {
+	case rdb.VolumeTypeBssd:
+		return nil
+	case rdb.VolumeTypeLssd:
+		if opts.AllowLSSD {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedVolumeType, instance.Volume.Type)
+}
+
+// checkProject returns an error if the instance does not belong to the
+// configured project, if any.
+func checkProject(instance *rdb.Instance, projectID string) error {
+	if projectID != "" && instance.ProjectID != projectID {
+		return fmt.Errorf("%w: instance belongs to project %s, not to the configured project %s", ErrConfig, instance.ProjectID, projectID)
+	}
+	return nil
+}
+
+// checkSizeLimit returns an error if the instance volume is already at or
+// above the size limit.
+func checkSizeLimit(instance *rdb.Instance, opts *Settings) error {
+	if _, ok := opts.sizeLimitFor(int64(instance.Volume.Size) + 1); !ok {
+		return fmt.Errorf("current volume size is larger than the defined limit: %w", ErrLimitReached)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package autoresize
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// cloudEventTypePrefix prefixes event types in CloudEvents envelopes, as
+// recommended by the specification.
+const cloudEventTypePrefix = "io.github.nlm.rdb-autoresize."
+
+// cloudEvent is a CloudEvents 1.0 envelope, in the structured JSON format.
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Type            string    `json:"type"`
+	Source          string    `json:"source"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            Event     `json:"data"`
+}
+
+// CloudEventsNotifier writes events as CloudEvents JSON envelopes, one per
+// line. The source is the URN of the instance.
+type CloudEventsNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewCloudEventsNotifier(w io.Writer) *CloudEventsNotifier {
+	return &CloudEventsNotifier{w: w}
+}
+
+func (cn *CloudEventsNotifier) Notify(ctx context.Context, event Event) error {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	ce := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id),
+		Type:            cloudEventTypePrefix + event.Type(),
+		Source:          "urn:scaleway:rdb",
+		DataContentType: "application/json",
+		Data:            event,
+	}
+	switch event := event.(type) {
+	case ResizeEvent:
+		ce.Time = event.Time
+		ce.Source = instanceURN(event.Region, event.InstanceID)
+		ce.Subject = event.InstanceName
+	case AlertEvent:
+		ce.Time = event.Time
+		ce.Source = instanceURN("", event.InstanceID)
+	}
+	body, err := json.Marshal(ce)
+	if err != nil {
+		return err
+	}
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	_, err = cn.w.Write(append(body, '\n'))
+	return err
+}
+
+// instanceURN returns the URN identifying an instance, such as
+// urn:scaleway:rdb:fr-par:instance:<id>. The region is omitted when unknown.
+func instanceURN(region, instanceID string) string {
+	urn := "urn:scaleway:rdb"
+	if region != "" {
+		urn += ":" + region
+	}
+	if instanceID != "" {
+		urn += ":instance:" + instanceID
+	}
+	return urn
+}
@@ -0,0 +1,1027 @@
+package autoresize
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+	"golang.org/x/time/rate"
+)
+
+// Status is a snapshot of the state of a controller.
+type Status struct {
+	InstanceID             string     `json:"instance_id"`
+	Region                 string     `json:"region"`
+	CurrentVolumeSizeBytes uint64     `json:"current_volume_size_bytes"`
+	LastDiskUsagePct       float64    `json:"last_disk_usage_pct"`
+	LastCheckTime          *time.Time `json:"last_check_time"`
+	LastResizeTime         *time.Time `json:"last_resize_time"`
+	ResizeCount            int        `json:"resize_count"`
+	VolumeSizeLimitBytes   int64      `json:"volume_size_limit_bytes"`
+	Paused                 bool       `json:"paused"`
+	LimitReached           bool       `json:"limit_reached"`
+	ConfigVersion          uint64     `json:"config_version"`
+	CircuitBreakerState    string     `json:"circuit_breaker_state"`
+	NextResizeAttempt      *time.Time `json:"next_resize_attempt"`
+}
+
+// Circuit breaker states of the resizes, see Status.
+const (
+	// CircuitBreakerClosed is the state in which resizes are attempted.
+	CircuitBreakerClosed = "closed"
+	// CircuitBreakerBackingOff is the state after failed resizes, until the
+	// next resize attempt.
+	CircuitBreakerBackingOff = "backing_off"
+)
+
+// instanceAPI is the set of instance operations used by the controller,
+// implemented by AutoResizer.
+type instanceAPI interface {
+	InstanceID() string
+	Region() string
+	GetInstance(ctx context.Context) (*rdb.Instance, error)
+	WaitForInstance(ctx context.Context, timeout time.Duration) (*rdb.Instance, error)
+	BackupInProgress(ctx context.Context, instance *rdb.Instance) (bool, error)
+	GetMaxVolumeSize(ctx context.Context, instance *rdb.Instance) (uint64, error)
+	GetMinVolumeSize(ctx context.Context, instance *rdb.Instance) (uint64, error)
+	ResizeVolume(ctx context.Context, newSize uint64) (*rdb.Instance, error)
+	ResizeVolumeWait(ctx context.Context, newSize uint64, pollInterval time.Duration) (*rdb.Instance, error)
+	UpgradeNodeType(ctx context.Context, nodeType string) (*rdb.Instance, error)
+	CreateSnapshotWait(ctx context.Context, name string, pollInterval time.Duration) (*rdb.Snapshot, error)
+	GetMetric(ctx context.Context, metricName string) (float64, error)
+	GetDiskUsagePercent(ctx context.Context) (float64, time.Time, error)
+	GetDiskIOPSPercent(ctx context.Context) (float64, error)
+	GetDiskUsageBytes(ctx context.Context) (usedBytes, totalBytes uint64, err error)
+	RawInstance(ctx context.Context) (json.RawMessage, error)
+	RawMetrics(ctx context.Context, metricName string) (json.RawMessage, error)
+}
+
+// Controller runs the control loop iterations for an instance.
+type Controller struct {
+	rdbAR    instanceAPI
+	opts     *Settings
+	cfg      *Config
+	notifier Notifier
+	// now returns the current time.
+	now func() time.Time
+	// preResizeCmd and postResizeCmd are the resize hook commands, they
+	// are not run when empty.
+	preResizeCmd  string
+	postResizeCmd string
+	// waitForResize blocks resizes until the instance is ready again.
+	waitForResize bool
+	// heartbeat is pinged after each poll, it may be nil.
+	heartbeat *heartbeat
+	// pushgateway receives the metrics after each iteration, it may be nil.
+	pushgateway *pushgateway
+	// otlp exports the metrics over otlp, it may be nil.
+	otlp *otlpMetrics
+	// historyFile records the resize events, it may be nil.
+	historyFile *historyFile
+	// nodeType is the last known node type of the instance.
+	nodeType string
+	// instance caches the instance metadata used in logs and notifications,
+	// it is refreshed each time the instance is fetched or upgraded.
+	instance *rdb.Instance
+	// nextCheck is when the instance is due for its next iteration, see
+	// dueControllers.
+	nextCheck time.Time
+	// iteration counts loop iterations, and is used to correlate the log
+	// entries of an iteration.
+	iteration uint64
+	history   usageHistory
+	// graceEnd is the end of the startup grace period, before which
+	// resizes are deferred.
+	graceEnd time.Time
+	// maxVolumeSize is the hard cap of the volume size, 0 if unknown. See
+	// maxVolumeSizeFor.
+	maxVolumeSize uint64
+	// minVolumeSize is the minimum size of resize targets, 0 if unknown.
+	// See minVolumeSizeFor.
+	minVolumeSize uint64
+	// usageAlerted is set once a usage alert is sent, until the usage is
+	// back under the alert threshold.
+	usageAlerted bool
+	// resizeSkipped is set once a skipped resize is notified in alert-only
+	// mode, until the usage goes back under the trigger.
+	resizeSkipped bool
+	// awaitingHealthy is set after a resize, until the usage is back to
+	// healthy levels.
+	awaitingHealthy bool
+	// resizeFailures counts consecutive resize failures, resizes are not
+	// attempted again before nextResizeAttempt, resizeBackoffDelay after
+	// the last failure.
+	resizeFailures     int
+	nextResizeAttempt  time.Time
+	resizeBackoffDelay time.Duration
+	// limiter bounds the resize rate of the instance, so that an instance
+	// resizing in a loop does not hold the workers. It may be nil.
+	limiter *rate.Limiter
+	// totalBytesAdded is the size added by resizes since startup.
+	totalBytesAdded uint64
+	// adaptive grows the increment on rapid resizes, with
+	// Settings.AdaptiveIncrement.
+	adaptive adaptiveState
+	// cpuHighChecks counts consecutive checks with the cpu usage over the
+	// cpu trigger, see checkCPU.
+	cpuHighChecks int
+	// failures counts consecutive failed iterations, to alert when they
+	// keep failing. lastFailure is the error of the last iteration.
+	failures    int
+	lastFailure error
+
+	// iterMu serializes the iterations, which can also be triggered by
+	// CheckNow, and the settings changes.
+	iterMu sync.Mutex
+
+	mu            sync.Mutex
+	status        Status
+	resizeHistory []ResizeRecord
+}
+
+func newController(rdbAR instanceAPI, opts *Settings, cfg *Config) *Controller {
+	return &Controller{
+		rdbAR:    rdbAR,
+		opts:     opts,
+		cfg:      cfg,
+		notifier: cfg.Notifier,
+		now:      time.Now,
+	}
+}
+
+// InstanceID returns the id of the instance of the controller.
+func (c *Controller) InstanceID() string {
+	return c.rdbAR.InstanceID()
+}
+
+// RawInstance returns the raw api response describing the instance, for
+// diagnostics.
+func (c *Controller) RawInstance(ctx context.Context) (json.RawMessage, error) {
+	return c.rdbAR.RawInstance(ctx)
+}
+
+// RawMetrics returns the raw api response of the instance metrics, all of
+// them when metricName is empty, for diagnostics.
+func (c *Controller) RawMetrics(ctx context.Context, metricName string) (json.RawMessage, error) {
+	return c.rdbAR.RawMetrics(ctx, metricName)
+}
+
+// Status returns a snapshot of the controller state.
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.status
+	status.Paused = c.cfg.Pause.Paused()
+	status.CircuitBreakerState = CircuitBreakerClosed
+	if status.NextResizeAttempt != nil && c.now().Before(*status.NextResizeAttempt) {
+		status.CircuitBreakerState = CircuitBreakerBackingOff
+	} else {
+		status.NextResizeAttempt = nil
+	}
+	return status
+}
+
+// updateStatus applies fn to the controller status.
+func (c *Controller) updateStatus(fn func(*Status)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(&c.status)
+}
+
+// updateInstanceStatus caches the instance metadata, and records the instance
+// details in the controller status.
+func (c *Controller) updateInstanceStatus(instance *rdb.Instance) {
+	c.instance = instance
+	limit, _ := c.opts.sizeLimitFor(int64(instance.Volume.Size) + 1)
+	c.updateStatus(func(s *Status) {
+		s.InstanceID = instance.ID
+		s.Region = instance.Region.String()
+		s.CurrentVolumeSizeBytes = uint64(instance.Volume.Size)
+		s.VolumeSizeLimitBytes = limit
+	})
+}
+
+// emergencyReason returns why the instance needs an emergency resize, or an
+// empty string if it does not.
+func (c *Controller) emergencyReason(instance *rdb.Instance, usage float64) string {
+	if c.opts.EmergencyPercent == 0 {
+		return ""
+	}
+	if instance.Status == rdb.InstanceStatusDiskFull {
+		return "disk full"
+	}
+	if usage >= c.opts.EmergencyPercent {
+		return "usage over emergency threshold"
+	}
+	return ""
+}
+
+// checkLimitHeadroom warns when the volume size is above the warning
+// percentage of the size limit, before resizes stop being possible.
+func (c *Controller) checkLimitHeadroom(logger *slog.Logger) {
+	if c.opts.LimitWarnPercent == 0 || c.instance == nil || len(c.opts.SizeLimits) == 0 {
+		return
+	}
+	size := int64(c.instance.Volume.Size)
+	limit := c.opts.SizeLimits[len(c.opts.SizeLimits)-1]
+	if float64(size) <= float64(limit)*c.opts.LimitWarnPercent/100 {
+		return
+	}
+	logger.Warn(
+		"volume size is close to the size limit",
+		slog.String("size", HumanSize(size)),
+		slog.String("limit_size", HumanSize(limit)),
+		slog.String("headroom", HumanSize(max(limit-size, 0))),
+		slog.Float64("warning_percentage", c.opts.LimitWarnPercent),
+	)
+}
+
+// checkUsageAlert sends a usage alert when the disk usage goes over the
+// alert threshold while staying under the trigger percentage, once until it
+// goes back under the threshold. Above the trigger, resizes are notified
+// instead.
+func (c *Controller) checkUsageAlert(logger *slog.Logger, usage float64) {
+	if c.opts.AlertPercent == 0 || c.opts.AlertPercent >= c.opts.TriggerPercent {
+		return
+	}
+	if usage <= c.opts.AlertPercent {
+		c.usageAlerted = false
+		return
+	}
+	if c.usageAlerted || usage > c.opts.TriggerPercent {
+		return
+	}
+	c.usageAlerted = true
+	logger.Warn(
+		"disk usage is over the alert threshold",
+		slog.Float64("percent_used", usage),
+		slog.Float64("alert_threshold_percentage", c.opts.AlertPercent),
+	)
+	event := c.newEvent(EventUsageAlert, "disk usage is over the alert threshold")
+	event.UsagePercent = usage
+	sendNotification(logger, c.notifier, event, c.cfg.QueryTimeout)
+}
+
+// setLimitReached enters or leaves the limit reached state, in which the
+// volume needs a resize over the size limit. Entering it sends a
+// notification, once until it is left, by the usage going back under the
+// trigger or the limit being raised.
+func (c *Controller) setLimitReached(logger *slog.Logger, reached bool, usage float64) {
+	if reached == c.Status().LimitReached {
+		if reached {
+			logger.Warn("volume size limit reached, manual action required", slog.Float64("percent_used", usage))
+		}
+		return
+	}
+	c.updateStatus(func(s *Status) { s.LimitReached = reached })
+	if !reached {
+		metricLimitReached.WithLabelValues(c.rdbAR.InstanceID(), c.rdbAR.Region()).Set(0)
+		logger.Info("volume size is no longer at the size limit", slog.Float64("percent_used", usage))
+		return
+	}
+	metricLimitReached.WithLabelValues(c.rdbAR.InstanceID(), c.rdbAR.Region()).Set(1)
+	logger.Error("volume size limit reached, manual action required", slog.Float64("percent_used", usage))
+	event := c.newEvent(EventLimitReached, "volume size limit reached, manual action required")
+	event.UsagePercent = usage
+	if c.instance != nil {
+		event.OldSize = uint64(c.instance.Volume.Size)
+	}
+	sendNotification(logger, c.notifier, event, c.cfg.QueryTimeout)
+}
+
+// newEvent returns an event about the instance, filled with the cached
+// instance metadata.
+func (c *Controller) newEvent(eventType string, message string) ResizeEvent {
+	event := NewResizeEvent(eventType, c.rdbAR.InstanceID(), message)
+	if c.instance != nil {
+		event.InstanceName = c.instance.Name
+		event.Region = c.instance.Region.String()
+		event.Engine = c.instance.Engine
+		event.NodeType = c.instance.NodeType
+	}
+	return event
+}
+
+// trackFailures counts consecutive failed iterations, and sends an alert when
+// they reach the alert threshold. The alert is sent once per failure run,
+// which a successful iteration ends. Past the maximum consecutive errors, it
+// notifies the shutdown and returns ErrTooManyErrors.
+func (c *Controller) trackFailures(logger *slog.Logger, err error) error {
+	if err == nil {
+		if c.failures >= c.cfg.AlertAfterFailures && c.cfg.AlertAfterFailures > 0 {
+			logger.Info("checks are succeeding again", slog.Int("consecutive_failures", c.failures))
+		}
+		c.failures = 0
+		return nil
+	}
+	c.failures++
+	if c.cfg.MaxConsecutiveErrors > 0 && c.failures > c.cfg.MaxConsecutiveErrors {
+		logger.Error(
+			"too many consecutive failed checks, giving up",
+			slog.Int("consecutive_failures", c.failures),
+			slog.Any("error", err),
+		)
+		err = fmt.Errorf("%w: %d failed checks in a row, last error: %w", ErrTooManyErrors, c.failures, err)
+		notifyShutdown(logger, c.notifier, c.rdbAR.InstanceID(), err, c.cfg.QueryTimeout)
+		return err
+	}
+	if c.failures != c.cfg.AlertAfterFailures {
+		return nil
+	}
+	logger.Warn("checks keep failing, sending alert", slog.Int("consecutive_failures", c.failures))
+	sendNotification(logger, c.notifier, NewAlertEvent(c.rdbAR.InstanceID(), c.failures, err), c.cfg.QueryTimeout)
+	return nil
+}
+
+// healthyMargin is how many percent under the trigger the usage must go for
+// the instance to be considered healthy again after a resize.
+const healthyMargin = 5
+
+// resizeBackoff returns how long to wait before attempting a resize again
+// after the given number of consecutive failures. It follows the backoff
+// policy, starting at the default loop interval, up to MaxResizeBackoff.
+func (c *Controller) resizeBackoff(failures int) time.Duration {
+	b := c.cfg.Backoff
+	b.Base = DefaultInterval
+	b.Max = c.cfg.MaxResizeBackoff
+	return b.Delay(failures)
+}
+
+// Resize trigger reasons.
+const (
+	triggeredByThreshold  = "threshold"
+	triggeredByFreeSpace  = "free_space"
+	triggeredByIOPS       = "iops"
+	triggeredByPrediction = "prediction"
+)
+
+// triggerReason returns why a resize should happen at the given disk usage
+// and iops utilization, or an empty string if it should not.
+func (c *Controller) triggerReason(logger *slog.Logger, usage float64, iopsUsage float64) string {
+	if reason := c.usageTriggerReason(logger, usage); reason != "" {
+		return reason
+	}
+	if c.opts.IOPSTriggerPercent > 0 && iopsUsage > c.opts.IOPSTriggerPercent {
+		return triggeredByIOPS
+	}
+	if c.opts.PredictHours == 0 {
+		return ""
+	}
+	predicted, ok := c.history.predict(c.now().Add(time.Duration(c.opts.PredictHours * float64(time.Hour))))
+	if !ok {
+		return ""
+	}
+	logger.Debug(
+		"predicted disk usage",
+		slog.Float64("predict_hours", c.opts.PredictHours),
+		slog.Float64("percent_predicted", predicted),
+	)
+	if predicted > c.opts.TriggerPercent {
+		return triggeredByPrediction
+	}
+	return ""
+}
+
+// usageTriggerReason returns which of the trigger percentage and free space
+// conditions fired, combined according to the trigger mode, or an empty
+// string if the disk usage does not trigger a resize. The free space is
+// computed from the volume size and the usage percentage.
+func (c *Controller) usageTriggerReason(logger *slog.Logger, usage float64) string {
+	overPercent := usage > c.opts.TriggerPercent
+	if c.opts.TriggerFreeSpace == 0 || c.instance == nil {
+		if overPercent {
+			return triggeredByThreshold
+		}
+		return ""
+	}
+	freeBytes := max(float64(c.instance.Volume.Size)*(100-usage)/100, 0)
+	underFree := freeBytes < float64(c.opts.TriggerFreeSpace)
+	logger.Debug(
+		"free space",
+		slog.String("free", HumanSize(uint64(freeBytes))),
+		slog.String("trigger_free_space", HumanSize(c.opts.TriggerFreeSpace)),
+		slog.String("trigger_mode", c.opts.TriggerMode),
+	)
+	switch {
+	case overPercent && underFree:
+		return triggeredByThreshold + "," + triggeredByFreeSpace
+	case c.opts.TriggerMode == TriggerModeAnd:
+		return ""
+	case overPercent:
+		return triggeredByThreshold
+	case underFree:
+		return triggeredByFreeSpace
+	}
+	return ""
+}
+
+// CheckNow runs a check of the instance immediately, outside of the loop
+// schedule, resizing its volume when needed. It returns the disk usage, and
+// whether a resize succeeded, or the error of the check.
+func (c *Controller) CheckNow(ctx context.Context) (diskPct float64, resized bool, err error) {
+	c.iterMu.Lock()
+	defer c.iterMu.Unlock()
+	resizeCount := c.Status().ResizeCount
+	if err := c.iterateLocked(ctx); err != nil {
+		return 0, false, err
+	}
+	if c.lastFailure != nil {
+		return 0, false, c.lastFailure
+	}
+	status := c.Status()
+	return status.LastDiskUsagePct, status.ResizeCount > resizeCount, nil
+}
+
+// iterate checks the disk usage of the instance and resizes its volume when
+// needed. It only returns an error when the instance cannot be handled
+// anymore, such as when reaching the size limit.
+func (c *Controller) iterate(ctx context.Context) error {
+	c.iterMu.Lock()
+	defer c.iterMu.Unlock()
+	return c.iterateLocked(ctx)
+}
+
+// iterateLocked is iterate, with iterMu held.
+func (c *Controller) iterateLocked(ctx context.Context) (fatal error) {
+	c.iteration++
+	logger := slog.With(
+		slog.Uint64("iteration", c.iteration),
+		slog.String("instance_id", c.rdbAR.InstanceID()),
+	)
+	if c.instance != nil {
+		logger = logger.With(
+			slog.String("instance_name", c.instance.Name),
+			slog.String("region", c.instance.Region.String()),
+			slog.String("engine", c.instance.Engine),
+			slog.String("node_type", c.instance.NodeType),
+		)
+	}
+	defer c.pushgateway.Push(logger)
+	var failure error
+	defer func() {
+		c.lastFailure = failure
+		if err := c.trackFailures(logger, failure); err != nil && fatal == nil {
+			fatal = err
+		}
+	}()
+
+	// Check current usage
+	v, err := func() (float64, error) {
+		ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+		defer cancel()
+		v, _, err := c.rdbAR.GetDiskUsagePercent(ctx)
+		return v, err
+	}()
+	if errors.Is(err, ErrNoMetricData) {
+		logger.Warn("no disk usage data available yet, skipping check")
+		return nil
+	}
+	if err != nil {
+		logger.Error("error getting current disk usage", slog.Any("error", err))
+		c.heartbeat.Ping(false)
+		failure = err
+		return nil
+	}
+	c.heartbeat.Ping(true)
+	logger.Info("current disk usage", slog.Float64("percent_used", v))
+	metricDiskUsagePercent.WithLabelValues(c.rdbAR.InstanceID(), c.rdbAR.Region()).Set(v)
+	c.otlp.setDiskUsagePercent(c.rdbAR.InstanceID(), c.rdbAR.Region(), v)
+	c.updateStatus(func(s *Status) {
+		now := c.now()
+		s.LastDiskUsagePct = v
+		s.LastCheckTime = &now
+	})
+	c.history.add(c.now(), v)
+	c.checkLimitHeadroom(logger)
+	if c.cfg.CollectUsageBytes {
+		err := func() error {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+			defer cancel()
+			used, total, err := c.rdbAR.GetDiskUsageBytes(ctx)
+			if err != nil {
+				return err
+			}
+			metricDiskUsedBytes.WithLabelValues(c.rdbAR.InstanceID(), c.rdbAR.Region()).Set(float64(used))
+			metricDiskTotalBytes.WithLabelValues(c.rdbAR.InstanceID(), c.rdbAR.Region()).Set(float64(total))
+			return nil
+		}()
+		if err != nil {
+			logger.Warn("error getting disk usage bytes", slog.Any("error", err))
+		}
+	}
+
+	// Notify when usage is back to healthy after a resize
+	if c.cfg.NotifyOnHealthy && c.awaitingHealthy && v < c.opts.TriggerPercent-healthyMargin {
+		c.awaitingHealthy = false
+		logger.Info("disk usage is back to healthy levels", slog.Float64("percent_used", v))
+		event := c.newEvent(EventHealthy, "disk usage is back to healthy levels")
+		event.UsagePercent = v
+		if lastResize := c.Status().LastResizeTime; lastResize != nil {
+			event.SinceLastResize = c.now().Sub(*lastResize).Round(time.Second).String()
+		}
+		sendNotification(logger, c.notifier, event, c.cfg.QueryTimeout)
+	}
+
+	// Alert below the trigger
+	c.checkUsageAlert(logger, v)
+
+	// Check iops utilization
+	var iopsUsage float64
+	if c.opts.IOPSTriggerPercent > 0 {
+		iopsUsage, err = func() (float64, error) {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+			defer cancel()
+			return c.rdbAR.GetDiskIOPSPercent(ctx)
+		}()
+		if err != nil {
+			logger.Warn("error getting disk iops utilization", slog.Any("error", err))
+		} else {
+			logger.Info("current disk iops utilization", slog.Float64("iops_percent_used", iopsUsage))
+		}
+	}
+
+	// Check cpu utilization
+	c.checkCPU(ctx, logger)
+
+	// Take action
+	triggeredBy := c.triggerReason(logger, v, iopsUsage)
+	if triggeredBy == "" {
+		c.setLimitReached(logger, false, v)
+		c.resizeSkipped = false
+		if c.opts.AdaptiveIncrement {
+			c.adaptive.calm(logger, c.now(), c.opts)
+		}
+		return nil
+	}
+	logger.Warn(
+		"disk space is over max usage target",
+		slog.Float64("percent_target", c.opts.TriggerPercent),
+		slog.Float64("percent_used", v),
+		slog.Float64("iops_percent_used", iopsUsage),
+		slog.String("triggered_by", triggeredBy),
+	)
+	if c.cfg.Pause.Paused() {
+		logger.Warn("resizing is paused, skipping resize")
+		return nil
+	}
+	if now := c.now(); now.Before(c.graceEnd) {
+		logger.Warn(
+			"resize deferred during the startup grace period",
+			slog.Duration("resizes_in", c.graceEnd.Sub(now).Round(time.Second)),
+		)
+		return nil
+	}
+	if now := c.now(); now.Before(c.nextResizeAttempt) {
+		logger.Warn(
+			"resize deferred after previous failures",
+			slog.Int("consecutive_failures", c.resizeFailures),
+			slog.Duration("backoff", c.resizeBackoffDelay),
+			slog.Duration("retry_in", c.nextResizeAttempt.Sub(now).Round(time.Second)),
+		)
+		return nil
+	}
+	if c.opts.RequireUptime > 0 && c.instance != nil && c.instance.CreatedAt != nil {
+		if uptime := c.now().Sub(*c.instance.CreatedAt); uptime < c.opts.RequireUptime {
+			logger.Debug(
+				"instance is younger than the required uptime, skipping resize",
+				slog.Duration("uptime", uptime.Round(time.Second)),
+				slog.Duration("require_uptime", c.opts.RequireUptime),
+			)
+			return nil
+		}
+	}
+
+	// Check instance information
+	instance, err := func() (*rdb.Instance, error) {
+		ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+		defer cancel()
+		return c.rdbAR.GetInstance(ctx)
+	}()
+	if err != nil {
+		logger.Error("error getting instance details", slog.Any("error", err))
+		failure = err
+		return nil
+	}
+
+	// Leave running backups alone, the resize is attempted again next check
+	if c.cfg.SkipResizeOnBackup {
+		backup, err := func() (bool, error) {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+			defer cancel()
+			return c.rdbAR.BackupInProgress(ctx, instance)
+		}()
+		if err != nil {
+			logger.Error("error checking for backups in progress", slog.Any("error", err))
+			failure = err
+			return nil
+		}
+		if backup {
+			logger.Info("resize deferred: backup in progress")
+			return nil
+		}
+	}
+
+	// Wait for in-progress operations to complete, then check again
+	if IsInstanceSettling(instance.Status) {
+		logger.Info(
+			"instance is being updated, waiting for it to settle",
+			slog.String("status", instance.Status.String()),
+		)
+		instance, err = func() (*rdb.Instance, error) {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.ResizeTimeout)
+			defer cancel()
+			return c.rdbAR.WaitForInstance(ctx, c.cfg.ResizeTimeout)
+		}()
+		if err != nil {
+			logger.Error("error waiting for instance to settle", slog.Any("error", err))
+			failure = err
+			return nil
+		}
+		logger.Info("instance settled", slog.String("status", instance.Status.String()))
+		v, err = func() (float64, error) {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+			defer cancel()
+			v, _, err := c.rdbAR.GetDiskUsagePercent(ctx)
+			return v, err
+		}()
+		if err != nil {
+			logger.Error("error getting current disk usage", slog.Any("error", err))
+			failure = err
+			return nil
+		}
+		logger.Info("current disk usage", slog.Float64("percent_used", v))
+		metricDiskUsagePercent.WithLabelValues(c.rdbAR.InstanceID(), c.rdbAR.Region()).Set(v)
+		c.otlp.setDiskUsagePercent(c.rdbAR.InstanceID(), c.rdbAR.Region(), v)
+		triggeredBy = c.triggerReason(logger, v, iopsUsage)
+		if triggeredBy == "" {
+			logger.Info("disk usage is back under max usage target, no resize needed")
+			return nil
+		}
+	}
+	metricVolumeSizeBytes.WithLabelValues(instance.ID, c.rdbAR.Region()).Set(float64(instance.Volume.Size))
+	c.otlp.setVolumeSizeBytes(instance.ID, c.rdbAR.Region(), float64(instance.Volume.Size))
+	c.updateInstanceStatus(instance)
+	logger.Debug(
+		"current volume size",
+		slog.String("size", HumanSize(instance.Volume.Size)),
+	)
+
+	// Refresh the size limit after a node type change
+	if instance.NodeType != c.nodeType {
+		logger.Info(
+			"instance node type changed",
+			slog.String("previous_node_type", c.nodeType),
+			slog.String("node_type", instance.NodeType),
+		)
+		err := func() error {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+			defer cancel()
+			return c.opts.resolveSizeLimit(ctx, logger, c.rdbAR, instance)
+		}()
+		if err != nil {
+			logger.Error("error refreshing volume size limit", slog.Any("error", err))
+			failure = err
+			return nil
+		}
+		c.maxVolumeSize, err = maxVolumeSizeFor(ctx, c.rdbAR, instance, c.opts, c.cfg.QueryTimeout)
+		if err != nil {
+			logger.Error("invalid volume size limit for the new node type", slog.Any("error", err))
+		}
+		c.minVolumeSize = minVolumeSizeFor(ctx, c.rdbAR, instance, c.opts, c.cfg.QueryTimeout)
+		c.nodeType = instance.NodeType
+	}
+	if err := checkVolumeType(instance, c.opts); err != nil {
+		logger.Error(
+			"volume type is non-resizeable",
+			slog.String("volume_type", instance.Volume.Type.String()),
+		)
+		notifyShutdown(logger, c.notifier, instance.ID, fmt.Errorf("volume type is non-resizeable: %s", instance.Volume.Type), c.cfg.QueryTimeout)
+		return err
+	}
+
+	// Compute target size
+	var usedBytes uint64
+	if c.opts.TargetFreeSpace > 0 || c.opts.MinFreeSpace > 0 {
+		usedBytes, _, err = func() (uint64, uint64, error) {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+			defer cancel()
+			return c.rdbAR.GetDiskUsageBytes(ctx)
+		}()
+		if err != nil {
+			logger.Error("error getting disk usage bytes", slog.Any("error", err))
+			failure = err
+			return nil
+		}
+	}
+	targetSize := c.opts.targetSizeFor(uint64(instance.Volume.Size), v, usedBytes)
+	if c.opts.AdaptiveIncrement {
+		increment := c.adaptive.beforeResize(logger, c.opts.incrementFor(v), c.opts, c.now(), c.Status().LastResizeTime)
+		targetSize = max(targetSize, uint64(instance.Volume.Size)+increment)
+	}
+	// Jump straight to the size limit in emergencies
+	emergency := c.emergencyReason(instance, v)
+	if emergency != "" {
+		if limit, ok := c.opts.sizeLimitFor(int64(instance.Volume.Size) + 1); ok && uint64(limit) > targetSize {
+			logger.Warn(
+				"emergency resize, jumping straight to the size limit",
+				slog.String("reason", emergency),
+				slog.String("step_target_size", HumanSize(targetSize)),
+				slog.String("target_size", HumanSize(limit)),
+			)
+			targetSize = uint64(limit)
+			triggeredBy = "emergency"
+		} else {
+			emergency = ""
+		}
+	}
+
+	// Clamp the target size, whatever the trigger
+	if size := uint64(instance.Volume.Size); c.opts.MaxResizeDelta > 0 && targetSize > size && targetSize-size > c.opts.MaxResizeDelta {
+		logger.Warn(
+			"resize delta over maximum, clamping",
+			slog.String("delta", HumanSize(targetSize-size)),
+			slog.String("max_resize_delta", HumanSize(c.opts.MaxResizeDelta)),
+		)
+		targetSize = size + c.opts.MaxResizeDelta
+	}
+	if targetSize < c.minVolumeSize {
+		logger.Warn(
+			"resize target under the minimum volume size, clamping",
+			slog.String("target_size", HumanSize(targetSize)),
+			slog.String("min_volume_size", HumanSize(c.minVolumeSize)),
+		)
+		targetSize = c.minVolumeSize
+	}
+	if emergency != "" {
+		event := c.newEvent(EventEmergency, fmt.Sprintf("emergency resize (%s), jumping straight to the size limit", emergency))
+		event.OldSize = uint64(instance.Volume.Size)
+		event.NewSize = targetSize
+		event.UsagePercent = v
+		event.TriggeredBy = triggeredBy
+		sendNotification(logger, c.notifier, event, c.cfg.QueryTimeout)
+	}
+
+	// Check size limit
+	volumeSizeLimit, ok := c.opts.sizeLimitFor(int64(targetSize))
+	if !ok {
+		logger.Error(
+			"new volume size is over limit",
+			slog.String("target_size", HumanSize(targetSize)),
+			slog.String("limit_size", HumanSize(c.opts.SizeLimits[len(c.opts.SizeLimits)-1])),
+		)
+	} else if c.maxVolumeSize != 0 && targetSize > c.maxVolumeSize {
+		logger.Error(
+			"new volume size is over the maximum volume size",
+			slog.String("target_size", HumanSize(targetSize)),
+			slog.String("max_size", HumanSize(c.maxVolumeSize)),
+		)
+		ok = false
+	}
+	if !ok {
+		if c.cfg.ExitOnLimit {
+			notifyShutdown(logger, c.notifier, instance.ID, fmt.Errorf("new volume size is over limit"), c.cfg.QueryTimeout)
+			return fmt.Errorf("new volume size is over limit: %w", ErrLimitReached)
+		}
+		c.setLimitReached(logger, true, v)
+		return nil
+	}
+	if currentLimit, _ := c.opts.sizeLimitFor(int64(instance.Volume.Size) + 1); currentLimit != volumeSizeLimit {
+		logger.Warn(
+			"size limit tier exhausted, advancing to next tier",
+			slog.String("previous_limit_size", HumanSize(currentLimit)),
+			slog.String("limit_size", HumanSize(volumeSizeLimit)),
+		)
+	}
+
+	// Check usage again, in case space was freed in the meantime
+	if c.cfg.RecheckBeforeResize {
+		fresh, err := func() (float64, error) {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+			defer cancel()
+			fresh, _, err := c.rdbAR.GetDiskUsagePercent(ctx)
+			return fresh, err
+		}()
+		if err != nil {
+			logger.Error("error checking disk usage before resize", slog.Any("error", err))
+			failure = err
+			return nil
+		}
+		if c.triggerReason(logger, fresh, iopsUsage) == "" {
+			logger.Warn(
+				"disk usage dropped under max usage target, resize aborted",
+				slog.Float64("percent_target", c.opts.TriggerPercent),
+				slog.Float64("percent_used", fresh),
+			)
+			return nil
+		}
+		v = fresh
+	}
+
+	// Stop there in alert-only mode, notifying the resize once
+	if c.cfg.AlertOnly {
+		logger.Info(
+			"alert-only mode: resize skipped",
+			slog.String("current_size", HumanSize(instance.Volume.Size)),
+			slog.String("target_size", HumanSize(targetSize)),
+		)
+		if !c.resizeSkipped {
+			c.resizeSkipped = true
+			event := c.newEvent(EventResizeSkipped, "volume resize needed, skipped in alert-only mode")
+			event.OldSize = uint64(instance.Volume.Size)
+			event.NewSize = targetSize
+			event.UsagePercent = v
+			event.TriggeredBy = triggeredBy
+			sendNotification(logger, c.notifier, event, c.cfg.QueryTimeout)
+		}
+		return nil
+	}
+
+	// Check the rate limit, a resize is only spent right before the resize
+	// request, not when the snapshot or the pre-resize hook abort it
+	if c.limiter != nil && c.limiter.TokensAt(c.now()) < 1 {
+		logger.Debug("per-instance resize rate reached, skipping resize until the next interval")
+		return nil
+	}
+
+	// Snapshot the instance
+	var snapshotID string
+	if c.cfg.SnapshotBeforeResize {
+		snapshot, err := func() (*rdb.Snapshot, error) {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.SnapshotTimeout)
+			defer cancel()
+			name := fmt.Sprintf("autoresize-%s", c.now().UTC().Format("20060102-150405"))
+			logger.Info("creating snapshot before resize", slog.String("snapshot_name", name))
+			return c.rdbAR.CreateSnapshotWait(ctx, name, resizePollDelay)
+		}()
+		if err != nil {
+			logger.Error("snapshot before resize failed, skipping resize", slog.Any("error", err))
+			event := c.newEvent(EventResizeFailed, "snapshot before resize failed, resize skipped")
+			event.OldSize = uint64(instance.Volume.Size)
+			event.NewSize = targetSize
+			event.UsagePercent = v
+			event.TriggeredBy = triggeredBy
+			event.Error = err.Error()
+			if snapshot != nil {
+				event.SnapshotID = snapshot.ID
+			}
+			sendNotification(logger, c.notifier, event, c.cfg.QueryTimeout)
+			failure = err
+			return nil
+		}
+		snapshotID = snapshot.ID
+		logger.Info("snapshot before resize created", slog.String("snapshot_id", snapshotID))
+	}
+
+	// Run pre-resize hook
+	if c.preResizeCmd != "" {
+		err := func() error {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+			defer cancel()
+			return runHook(ctx, logger, "pre-resize", c.preResizeCmd, hookEnv(instance, targetSize, v))
+		}()
+		if err != nil {
+			logger.Error("resize aborted by pre-resize hook", slog.Any("error", err))
+			failure = err
+			return nil
+		}
+	}
+
+	// Do the resize
+	if c.limiter != nil {
+		c.limiter.AllowN(c.now(), 1)
+	}
+	err = func() error {
+		ctx, cancel := context.WithTimeout(ctx, c.cfg.ResizeTimeout)
+		defer cancel()
+		logger.Warn(
+			"triggering resize",
+			slog.String("current_size", HumanSize(instance.Volume.Size)),
+			slog.String("target_size", HumanSize(targetSize)),
+			slog.String("triggered_by", triggeredBy),
+			slog.String("snapshot_id", snapshotID),
+		)
+		var upgraded *rdb.Instance
+		var err error
+		if c.waitForResize {
+			upgraded, err = c.rdbAR.ResizeVolumeWait(ctx, targetSize, resizePollDelay)
+		} else {
+			upgraded, err = c.rdbAR.ResizeVolume(ctx, targetSize)
+		}
+		if upgraded != nil {
+			c.instance = upgraded
+		}
+		return err
+	}()
+
+	// Run post-resize hook
+	if c.postResizeCmd != "" {
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		hookErr := func() error {
+			ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+			defer cancel()
+			env := append(hookEnv(instance, targetSize, v), "RDB_AUTORESIZE_RESULT="+result)
+			return runHook(ctx, logger, "post-resize", c.postResizeCmd, env)
+		}()
+		if hookErr != nil {
+			logger.Error("post-resize hook failed", slog.Any("error", hookErr))
+		}
+	}
+
+	event := c.newEvent(EventResize, "volume resize triggered")
+	event.OldSize = uint64(instance.Volume.Size)
+	event.NewSize = targetSize
+	event.UsagePercent = v
+	event.TriggeredBy = triggeredBy
+	event.SnapshotID = snapshotID
+	if err != nil {
+		event.EventType = EventResizeFailed
+		event.Message = "volume resize failed"
+		event.Error = err.Error()
+	}
+	sendNotification(logger, c.notifier, event, c.cfg.QueryTimeout)
+	c.historyFile.Append(logger, event)
+	c.recordResize(ResizeRecord{
+		Time:         c.now(),
+		InstanceID:   instance.ID,
+		OldSize:      event.OldSize,
+		NewSize:      targetSize,
+		UsagePercent: v,
+		TriggeredBy:  triggeredBy,
+		SnapshotID:   snapshotID,
+		Error:        event.Error,
+	})
+	if err != nil {
+		metricResizeTotal.WithLabelValues(instance.ID, c.rdbAR.Region(), "failure").Inc()
+		c.otlp.incResizeTotal(instance.ID, c.rdbAR.Region(), "failure")
+		c.resizeFailures++
+		backoff := c.resizeBackoff(c.resizeFailures)
+		c.nextResizeAttempt = c.now().Add(backoff)
+		c.resizeBackoffDelay = backoff
+		c.updateStatus(func(s *Status) {
+			next := c.nextResizeAttempt
+			s.NextResizeAttempt = &next
+		})
+		logger.Error(
+			"unable to resize instance",
+			slog.Any("error", err),
+			slog.Duration("backoff", backoff),
+		)
+		failure = err
+		return nil
+	}
+	metricResizeTotal.WithLabelValues(instance.ID, c.rdbAR.Region(), "success").Inc()
+	c.otlp.incResizeTotal(instance.ID, c.rdbAR.Region(), "success")
+	c.resizeFailures = 0
+	c.setLimitReached(logger, false, v)
+	c.nextResizeAttempt = time.Time{}
+	c.updateStatus(func(s *Status) {
+		now := c.now()
+		s.NextResizeAttempt = nil
+		s.LastResizeTime = &now
+		s.ResizeCount++
+	})
+	// The status and metrics were recorded before the resize, record the
+	// upgraded volume size.
+	metricVolumeSizeBytes.WithLabelValues(instance.ID, c.rdbAR.Region()).Set(float64(c.instance.Volume.Size))
+	c.otlp.setVolumeSizeBytes(instance.ID, c.rdbAR.Region(), float64(c.instance.Volume.Size))
+	c.updateInstanceStatus(c.instance)
+	c.awaitingHealthy = true
+	added := targetSize - uint64(instance.Volume.Size)
+	c.totalBytesAdded += added
+	metricTotalBytesAdded.WithLabelValues(instance.ID, c.rdbAR.Region()).Add(float64(added))
+	logger.Info(
+		"volume resized",
+		slog.String("new_size", HumanSize(targetSize)),
+		slog.String("total_added_since_start", HumanSize(c.totalBytesAdded)),
+	)
+	return nil
+}
+
+// applySettings replaces the settings of the controller, resolving their
+// size limit for the instance, and increments the configuration version.
+// The current settings and version are kept on error.
+func (c *Controller) applySettings(ctx context.Context, opts *Settings) {
+	c.iterMu.Lock()
+	defer c.iterMu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+	defer cancel()
+	logger := slog.With(slog.String("instance_id", c.rdbAR.InstanceID()))
+	if err := opts.resolveSizeLimit(ctx, logger, c.rdbAR, c.instance); err != nil {
+		logger.Error("error applying reloaded configuration, keeping the current one", slog.Any("error", err))
+		return
+	}
+	if c.limiter != nil && opts.Interval != c.opts.Interval {
+		c.limiter.SetLimit(resizeLimit(c.cfg.ResizeRate, opts.Interval))
+	}
+	c.opts = opts
+	c.updateInstanceStatus(c.instance)
+	c.updateStatus(func(s *Status) { s.ConfigVersion++ })
+}
@@ -0,0 +1,116 @@
+package autoresize
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// newTestController returns a controller of rdbAR resizing by 10GB over
+// 90% usage, up to 100GB.
+func newTestController(rdbAR instanceAPI, nodeType string) *Controller {
+	cfg := &Config{}
+	cfg.setDefaults()
+	opts := &Settings{
+		TriggerPercent: 90,
+		SizeLimits:     []int64{100_000_000_000},
+		Increment:      10_000_000_000,
+		Interval:       time.Minute,
+	}
+	c := newController(rdbAR, opts, cfg)
+	c.nodeType = nodeType
+	return c
+}
+
+func TestControllerIterate(t *testing.T) {
+	tests := []struct {
+		name        string
+		usage       float32
+		wantUpgrade bool
+		wantSize    uint64
+	}{
+		{name: "over the trigger", usage: 95, wantUpgrade: true, wantSize: 60_000_000_000},
+		{name: "under the trigger", usage: 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ar := newFakeRDB(t)
+			f.setUsage(tt.usage)
+			c := newTestController(ar, f.instance.NodeType)
+			if err := c.iterate(context.Background()); err != nil {
+				t.Fatalf("iterate() error = %v", err)
+			}
+			if c.lastFailure != nil {
+				t.Fatalf("iterate() failed: %v", c.lastFailure)
+			}
+			upgrades := f.upgradeRequests()
+			if !tt.wantUpgrade {
+				if len(upgrades) != 0 {
+					t.Fatalf("got %d upgrade requests, want none", len(upgrades))
+				}
+				return
+			}
+			if len(upgrades) != 1 {
+				t.Fatalf("got %d upgrade requests, want 1", len(upgrades))
+			}
+			if got := upgrades[0].VolumeSize; got == nil || *got != tt.wantSize {
+				t.Fatalf("upgrade volume size = %v, want %d", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestResizeRateAbortedByPreHook(t *testing.T) {
+	f, ar := newFakeRDB(t)
+	f.setUsage(95)
+	c := newTestController(ar, f.instance.NodeType)
+	c.limiter = rate.NewLimiter(resizeLimit(1, c.opts.Interval), resizeBurst(1))
+
+	// the pre-resize command aborts the first resize
+	c.preResizeCmd = "exit 1"
+	if err := c.iterate(context.Background()); err != nil {
+		t.Fatalf("iterate() error = %v", err)
+	}
+	if upgrades := f.upgradeRequests(); len(upgrades) != 0 {
+		t.Fatalf("got %d upgrade requests, want none", len(upgrades))
+	}
+
+	// the aborted resize did not spend the rate of the interval
+	c.preResizeCmd = "true"
+	if err := c.iterate(context.Background()); err != nil {
+		t.Fatalf("iterate() error = %v", err)
+	}
+	if upgrades := f.upgradeRequests(); len(upgrades) != 1 {
+		t.Fatalf("got %d upgrade requests, want 1", len(upgrades))
+	}
+}
+
+// BenchmarkControlLoopDecision measures the resize decision of an
+// iteration: the trigger evaluation, the target size computation and the
+// size limit check, on a volume below its size limit. The log output is
+// discarded, and api calls are left out.
+func BenchmarkControlLoopDecision(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sim := newSimulatedInstance(logger, 50_000_000_000)
+	instance, _ := sim.GetInstance(context.Background())
+	c := newTestController(sim, instance.NodeType)
+	c.instance = instance
+	c.opts.TargetFreeSpace = 20_000_000_000
+	const usage = 95
+	usedBytes := uint64(float64(instance.Volume.Size) * usage / 100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if c.triggerReason(logger, usage, 0) == "" {
+			b.Fatal("no resize triggered")
+		}
+		targetSize := c.opts.targetSizeFor(uint64(instance.Volume.Size), usage, usedBytes)
+		if _, ok := c.opts.sizeLimitFor(int64(targetSize)); !ok {
+			b.Fatal("size limit reached")
+		}
+	}
+}
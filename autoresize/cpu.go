@@ -0,0 +1,94 @@
+package autoresize
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+)
+
+// cpuSustainedChecks is the number of consecutive checks the cpu usage must
+// be over the cpu trigger for, before a node type upgrade is triggered.
+const cpuSustainedChecks = 3
+
+// checkCPU upgrades the node type of the instance when its cpu usage stays
+// over the cpu trigger for cpuSustainedChecks checks. Without an upgrade
+// node type, or in alert-only mode, a notification is sent instead.
+func (c *Controller) checkCPU(ctx context.Context, logger *slog.Logger) {
+	if c.opts.CPUTriggerPercent == 0 {
+		return
+	}
+	usage, err := func() (float64, error) {
+		ctx, cancel := context.WithTimeout(ctx, c.cfg.QueryTimeout)
+		defer cancel()
+		return c.rdbAR.GetMetric(ctx, "cpu_usage_percent")
+	}()
+	if errors.Is(err, ErrNoMetricData) {
+		return
+	}
+	if err != nil {
+		logger.Warn("error getting cpu usage", slog.Any("error", err))
+		return
+	}
+	logger.Info("current cpu usage", slog.Float64("cpu_percent_used", usage))
+	if usage <= c.opts.CPUTriggerPercent {
+		c.cpuHighChecks = 0
+		return
+	}
+	c.cpuHighChecks++
+	if c.cpuHighChecks < cpuSustainedChecks {
+		return
+	}
+	c.cpuHighChecks = 0
+	logger.Warn(
+		"cpu usage is sustained over max usage target",
+		slog.Float64("cpu_percent_target", c.opts.CPUTriggerPercent),
+		slog.Float64("cpu_percent_used", usage),
+	)
+	nodeType := c.opts.CPUUpgradeNodeType
+	if nodeType == "" || nodeType == c.nodeType {
+		event := c.newEvent(EventNodeUpgrade, fmt.Sprintf("cpu usage is sustained at %.1f%%, a node type upgrade is recommended", usage))
+		event.TriggeredBy = "cpu"
+		sendNotification(logger, c.notifier, event, c.cfg.QueryTimeout)
+		return
+	}
+	if c.cfg.Pause.Paused() {
+		logger.Warn("resizing is paused, skipping node type upgrade")
+		return
+	}
+	if c.cfg.AlertOnly {
+		logger.Info(
+			"alert-only mode: node type upgrade skipped",
+			slog.String("current_node_type", c.nodeType),
+			slog.String("target_node_type", nodeType),
+		)
+		event := c.newEvent(EventNodeUpgrade, fmt.Sprintf("cpu usage is sustained at %.1f%%, a node type upgrade to %s is recommended", usage, nodeType))
+		event.TriggeredBy = "cpu"
+		sendNotification(logger, c.notifier, event, c.cfg.QueryTimeout)
+		return
+	}
+
+	logger.Warn(
+		"triggering node type upgrade",
+		slog.String("current_node_type", c.nodeType),
+		slog.String("target_node_type", nodeType),
+	)
+	upgraded, err := func() (*rdb.Instance, error) {
+		ctx, cancel := context.WithTimeout(ctx, c.cfg.ResizeTimeout)
+		defer cancel()
+		return c.rdbAR.UpgradeNodeType(ctx, nodeType)
+	}()
+	event := c.newEvent(EventNodeUpgrade, fmt.Sprintf("node type upgrade to %s triggered", nodeType))
+	event.TriggeredBy = "cpu"
+	if err != nil {
+		logger.Error("error upgrading node type", slog.Any("error", err))
+		event.Message = fmt.Sprintf("node type upgrade to %s failed", nodeType)
+		event.Error = err.Error()
+	} else {
+		c.instance = upgraded
+		logger.Info("node type upgraded", slog.String("node_type", nodeType))
+	}
+	sendNotification(logger, c.notifier, event, c.cfg.QueryTimeout)
+}
@@ -0,0 +1,150 @@
+package autoresize
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// EmailNotifier sends events as plain text emails through an SMTP server.
+type EmailNotifier struct {
+	host     string
+	port     string
+	from     string
+	to       []string
+	startTLS bool
+}
+
+// NewEmailNotifier creates an email notifier. to is a comma-separated list of
+// recipients.
+func NewEmailNotifier(host, port, from, to string, startTLS bool) *EmailNotifier {
+	var recipients []string
+	for _, address := range strings.Split(to, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			recipients = append(recipients, address)
+		}
+	}
+	return &EmailNotifier{
+		host:     host,
+		port:     port,
+		from:     from,
+		to:       recipients,
+		startTLS: startTLS,
+	}
+}
+
+// emailSubject returns the subject of the email for event, with the
+// instance id and the outcome.
+func emailSubject(event Event) string {
+	switch event := event.(type) {
+	case ResizeEvent:
+		outcome := event.EventType
+		switch event.EventType {
+		case EventResize:
+			outcome = "resize success"
+		case EventResizeFailed:
+			outcome = "resize failure"
+		case EventUsageAlert:
+			outcome = "usage alert"
+		case EventResizeSkipped:
+			outcome = "resize skipped (alert-only)"
+		case EventPermissionMissing:
+			outcome = "missing resize permission"
+		}
+		return fmt.Sprintf("[rdb-autoresize] %s: %s", event.InstanceID, outcome)
+	case AlertEvent:
+		return fmt.Sprintf("[rdb-autoresize] %s: alert", event.InstanceID)
+	}
+	return "[rdb-autoresize] " + event.Type()
+}
+
+// emailBody returns the plain text body of the email for event.
+func emailBody(event Event) string {
+	var b strings.Builder
+	line := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+		}
+	}
+	switch event := event.(type) {
+	case ResizeEvent:
+		b.WriteString(event.Message + "\r\n\r\n")
+		line("Time", event.Time.Format(time.RFC3339))
+		line("Instance ID", event.InstanceID)
+		line("Instance name", event.InstanceName)
+		line("Region", event.Region)
+		line("Node type", event.NodeType)
+		if event.OldSize != 0 {
+			line("Old size", HumanSize(event.OldSize))
+		}
+		if event.NewSize != 0 {
+			line("New size", HumanSize(event.NewSize))
+		}
+		if event.UsagePercent != 0 {
+			line("Disk usage", fmt.Sprintf("%.1f%%", event.UsagePercent))
+		}
+		line("Triggered by", event.TriggeredBy)
+		line("Error", event.Error)
+		line("Console", consoleURL(event))
+	case AlertEvent:
+		b.WriteString(event.Message + "\r\n\r\n")
+		line("Time", event.Time.Format(time.RFC3339))
+		line("Instance ID", event.InstanceID)
+		line("Failures", fmt.Sprint(event.FailureCount))
+		line("Last error", event.LastError)
+	}
+	return b.String()
+}
+
+func (en *EmailNotifier) Notify(ctx context.Context, event Event) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(en.host, en.port))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, en.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if en.startTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: en.host}); err != nil {
+			return fmt.Errorf("error starting tls: %w", err)
+		}
+	}
+	if err := client.Mail(en.from); err != nil {
+		return err
+	}
+	for _, to := range en.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		en.from,
+		strings.Join(en.to, ", "),
+		emailSubject(event),
+		time.Now().Format(time.RFC1123Z),
+		emailBody(event),
+	)
+	if _, err := w.Write([]byte(message)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
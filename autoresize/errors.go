@@ -0,0 +1,26 @@
+package autoresize
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// Errors returned by Run and the pre-checks, by class of failure.
+var (
+	ErrUnsupportedVolumeType = errors.New("unsupported volume type")
+	ErrLimitReached          = errors.New("volume size limit reached")
+	ErrConfig                = errors.New("invalid configuration")
+	ErrTooManyErrors         = errors.New("too many consecutive errors")
+)
+
+// IsAuthError reports whether err is caused by invalid credentials.
+func IsAuthError(err error) bool {
+	var deniedErr *scw.DeniedAuthenticationError
+	if errors.As(err, &deniedErr) {
+		return true
+	}
+	var respErr *scw.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusUnauthorized
+}
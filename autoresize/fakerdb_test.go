@@ -0,0 +1,114 @@
+package autoresize
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+const fakeInstanceID = "11111111-1111-1111-1111-111111111111"
+
+// fakeRDB is an http server mimicking the rdb endpoints used by the
+// controller: GetInstance, GetInstanceMetrics and UpgradeInstance.
+type fakeRDB struct {
+	mu       sync.Mutex
+	instance rdb.Instance
+	// metrics is returned by GetInstanceMetrics, whatever the metric name.
+	metrics rdb.InstanceMetrics
+	// upgrades records the UpgradeInstance requests.
+	upgrades []rdb.UpgradeInstanceRequest
+	// onGetInstance is called on each GetInstance request, if set.
+	onGetInstance func()
+}
+
+// newFakeRDB starts a fakeRDB serving a ready instance with a 50GB bssd
+// volume, and returns an AutoResizer pointed at it.
+func newFakeRDB(t *testing.T) (*fakeRDB, *AutoResizer) {
+	t.Helper()
+	f := &fakeRDB{
+		instance: rdb.Instance{
+			ID:       fakeInstanceID,
+			Name:     "fake",
+			Region:   scw.RegionFrPar,
+			Status:   rdb.InstanceStatusReady,
+			Engine:   "PostgreSQL-15",
+			NodeType: "db-dev-s",
+			Volume: &rdb.Volume{
+				Type: rdb.VolumeTypeBssd,
+				Size: 50 * scw.GB,
+			},
+		},
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	client, err := scw.NewClient(
+		scw.WithAPIURL(srv.URL),
+		scw.WithAuth("SCWXXXXXXXXXXXXXXXXX", "11111111-1111-1111-1111-111111111111"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, NewAutoResizer(client, scw.RegionFrPar.String(), fakeInstanceID)
+}
+
+// setUsage makes GetInstanceMetrics return a single data point of value,
+// timestamped now.
+func (f *fakeRDB) setUsage(value float32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metrics = rdb.InstanceMetrics{Timeseries: []*scw.TimeSeries{{
+		Name:   "disk_usage_percent",
+		Points: []*scw.TimeSeriesPoint{{Timestamp: time.Now(), Value: value}},
+	}}}
+}
+
+// upgradeRequests returns the UpgradeInstance requests received.
+func (f *fakeRDB) upgradeRequests() []rdb.UpgradeInstanceRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]rdb.UpgradeInstanceRequest(nil), f.upgrades...)
+}
+
+func (f *fakeRDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/rdb/v1/regions/"+scw.RegionFrPar.String()+"/instances/"+fakeInstanceID)
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		if f.onGetInstance != nil {
+			f.onGetInstance()
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		writeFakeJSON(w, f.instance)
+	case r.Method == http.MethodGet && path == "/metrics":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		writeFakeJSON(w, f.metrics)
+	case r.Method == http.MethodPost && path == "/upgrade":
+		var req rdb.UpgradeInstanceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.upgrades = append(f.upgrades, req)
+		if req.VolumeSize != nil {
+			f.instance.Volume.Size = scw.Size(*req.VolumeSize)
+		}
+		writeFakeJSON(w, f.instance)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeFakeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
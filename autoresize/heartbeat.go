@@ -0,0 +1,55 @@
+package autoresize
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// heartbeat pings an external health check url, in the style of
+// healthchecks.io: the url on success, and the url suffixed with /fail on
+// failure.
+type heartbeat struct {
+	url       string
+	userAgent string
+	client    *http.Client
+}
+
+func newHeartbeat(url string, timeout time.Duration, userAgent string) *heartbeat {
+	return &heartbeat{
+		url:       strings.TrimSuffix(url, "/"),
+		userAgent: userAgent,
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// Ping sends a heartbeat in the background. Errors are only logged, as the
+// endpoint being down must not affect the control loop.
+func (h *heartbeat) Ping(success bool) {
+	if h == nil {
+		return
+	}
+	url := h.url
+	if !success {
+		url += "/fail"
+	}
+	go func() {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+		if err != nil {
+			slog.Warn("error creating heartbeat request", slog.Any("error", err))
+			return
+		}
+		req.Header.Set("User-Agent", h.userAgent)
+		resp, err := h.client.Do(req)
+		if err != nil {
+			slog.Warn("error sending heartbeat", slog.Any("error", err))
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.Warn("heartbeat endpoint returned unexpected status", slog.String("status", resp.Status))
+		}
+	}()
+}
@@ -0,0 +1,38 @@
+package autoresize
+
+import (
+	"time"
+)
+
+// resizeHistorySize is the number of resize records kept per instance.
+const resizeHistorySize = 100
+
+// ResizeRecord is an entry of the resize history.
+type ResizeRecord struct {
+	Time         time.Time `json:"time"`
+	InstanceID   string    `json:"instance_id"`
+	OldSize      uint64    `json:"old_size"`
+	NewSize      uint64    `json:"new_size"`
+	UsagePercent float64   `json:"usage_percent"`
+	TriggeredBy  string    `json:"triggered_by"`
+	SnapshotID   string    `json:"snapshot_id,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// recordResize adds a resize attempt to the history, dropping the oldest
+// records past resizeHistorySize.
+func (c *Controller) recordResize(record ResizeRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resizeHistory = append(c.resizeHistory, record)
+	if len(c.resizeHistory) > resizeHistorySize {
+		c.resizeHistory = c.resizeHistory[len(c.resizeHistory)-resizeHistorySize:]
+	}
+}
+
+// ResizeHistory returns the recent resize attempts, oldest first.
+func (c *Controller) ResizeHistory() []ResizeRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ResizeRecord(nil), c.resizeHistory...)
+}
@@ -0,0 +1,114 @@
+package autoresize
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// historyFile records the resize events in a JSON Lines file, one
+// ResizeEvent per line, to restore the resize history after a restart.
+type historyFile struct {
+	mu   sync.Mutex
+	path string
+}
+
+// readHistoryFile returns the resize events recorded in the file at path,
+// oldest first. A missing file has no events, and malformed lines are
+// skipped.
+func readHistoryFile(path string) ([]ResizeEvent, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening history file: %w", err)
+	}
+	defer f.Close()
+	var events []ResizeEvent
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event ResizeEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			slog.Warn("skipping malformed history file line", slog.String("path", path), slog.Int("line", line), slog.Any("error", err))
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history file: %w", err)
+	}
+	return events, nil
+}
+
+// Append adds event to the file. Errors are only logged.
+func (h *historyFile) Append(logger *slog.Logger, event ResizeEvent) {
+	if h == nil {
+		return
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		logger.Warn("error encoding history file event", slog.Any("error", err))
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		logger.Warn("error opening history file", slog.String("path", h.path), slog.Any("error", err))
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		logger.Warn("error writing history file", slog.String("path", h.path), slog.Any("error", err))
+	}
+}
+
+// restoreHistory restores the resize history, count and last resize time of
+// the controller from the recorded events of its instance.
+func (c *Controller) restoreHistory(events []ResizeEvent) {
+	var restored int
+	for _, event := range events {
+		if event.InstanceID != c.rdbAR.InstanceID() {
+			continue
+		}
+		restored++
+		c.recordResize(ResizeRecord{
+			Time:         event.Time,
+			InstanceID:   event.InstanceID,
+			OldSize:      event.OldSize,
+			NewSize:      event.NewSize,
+			UsagePercent: event.UsagePercent,
+			TriggeredBy:  event.TriggeredBy,
+			SnapshotID:   event.SnapshotID,
+			Error:        event.Error,
+		})
+		if event.EventType != EventResize {
+			continue
+		}
+		c.updateStatus(func(s *Status) {
+			s.ResizeCount++
+			if s.LastResizeTime == nil || event.Time.After(*s.LastResizeTime) {
+				resizeTime := event.Time
+				s.LastResizeTime = &resizeTime
+			}
+		})
+	}
+	if restored > 0 {
+		status := c.Status()
+		slog.Info(
+			"resize history restored",
+			slog.String("instance_id", c.rdbAR.InstanceID()),
+			slog.Int("events", restored),
+			slog.Int("resize_count", status.ResizeCount),
+		)
+	}
+}
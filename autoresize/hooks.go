@@ -0,0 +1,54 @@
+package autoresize
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+)
+
+// hookWaitDelay bounds the wait for the output of a hook command once its
+// context is done, in case a background child keeps stdout or stderr open.
+const hookWaitDelay = 5 * time.Second
+
+// hookEnv returns the environment variables describing a resize event,
+// as exposed to the pre and post resize commands.
+func hookEnv(instance *rdb.Instance, targetSize uint64, usage float64) []string {
+	return []string{
+		"RDB_AUTORESIZE_INSTANCE_ID=" + instance.ID,
+		"RDB_AUTORESIZE_REGION=" + instance.Region.String(),
+		"RDB_AUTORESIZE_OLD_SIZE=" + strconv.FormatUint(uint64(instance.Volume.Size), 10),
+		"RDB_AUTORESIZE_NEW_SIZE=" + strconv.FormatUint(targetSize, 10),
+		"RDB_AUTORESIZE_USAGE_PERCENT=" + strconv.FormatFloat(usage, 'f', 2, 64),
+	}
+}
+
+// runHook executes command through the shell with env appended to the
+// current environment. The command output is captured and logged.
+func runHook(ctx context.Context, logger *slog.Logger, name string, command string, env []string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = hookWaitDelay
+	err := cmd.Run()
+	logger.Info(
+		"resize hook executed",
+		slog.String("hook", name),
+		slog.String("command", command),
+		slog.String("stdout", stdout.String()),
+		slog.String("stderr", stderr.String()),
+		slog.Bool("success", err == nil),
+	)
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package autoresize
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricDiskUsagePercent = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rdb_autoresize_disk_usage_percent",
+		Help: "Disk usage of the instance volume, in percent.",
+	}, []string{"instance_id", "region"})
+	metricDiskUsedBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rdb_autoresize_disk_used_bytes",
+		Help: "Used bytes on the instance disk.",
+	}, []string{"instance_id", "region"})
+	metricDiskTotalBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rdb_autoresize_disk_total_bytes",
+		Help: "Total bytes of the instance disk.",
+	}, []string{"instance_id", "region"})
+	metricVolumeSizeBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rdb_autoresize_volume_size_bytes",
+		Help: "Size of the instance volume, in bytes.",
+	}, []string{"instance_id", "region"})
+	metricResizeTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rdb_autoresize_resize_total",
+		Help: "Number of resize attempts, by result.",
+	}, []string{"instance_id", "region", "result"})
+	metricLimitReached = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rdb_autoresize_limit_reached",
+		Help: "Whether the instance volume needs a resize over the size limit, 1 if so.",
+	}, []string{"instance_id", "region"})
+	metricResizePermission = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rdb_autoresize_resize_permission",
+		Help: "Whether the api credentials are allowed to resize instances, 1 if so, unset if unknown.",
+	})
+	metricTotalBytesAdded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rdb_autoresize_total_bytes_added",
+		Help: "Bytes added to the instance volume by resizes since startup.",
+	}, []string{"instance_id", "region"})
+)
+
+var (
+	descSecondsSinceLastResize = prometheus.NewDesc(
+		"rdb_autoresize_seconds_since_last_resize",
+		"Seconds since the last successful resize.",
+		[]string{"instance_id", "region"}, nil,
+	)
+	descSecondsSinceLastPoll = prometheus.NewDesc(
+		"rdb_autoresize_seconds_since_last_successful_poll",
+		"Seconds since the last successful disk usage check.",
+		[]string{"instance_id", "region"}, nil,
+	)
+)
+
+// sinceCollector exposes the time elapsed since the last resize and the last
+// successful check of the controllers, computed when collected.
+type sinceCollector struct {
+	controllers []*Controller
+}
+
+func (sc sinceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- descSecondsSinceLastResize
+	ch <- descSecondsSinceLastPoll
+}
+
+func (sc sinceCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range sc.controllers {
+		status := c.Status()
+		if status.LastResizeTime != nil {
+			ch <- prometheus.MustNewConstMetric(
+				descSecondsSinceLastResize, prometheus.GaugeValue,
+				time.Since(*status.LastResizeTime).Seconds(), status.InstanceID, status.Region,
+			)
+		}
+		if status.LastCheckTime != nil {
+			ch <- prometheus.MustNewConstMetric(
+				descSecondsSinceLastPoll, prometheus.GaugeValue,
+				time.Since(*status.LastCheckTime).Seconds(), status.InstanceID, status.Region,
+			)
+		}
+	}
+}
+
+// writeMetricsFile writes the metrics to path in the prometheus text format,
+// for the node-exporter textfile collector. The file is replaced atomically
+// by a rename. Errors are only logged.
+func writeMetricsFile(path string) {
+	if err := prometheus.WriteToTextfile(path, prometheus.DefaultGatherer); err != nil {
+		slog.Warn("error writing metrics file", slog.String("path", path), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,194 @@
+package autoresize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Event types sent to notifiers.
+const (
+	EventStartup      = "startup"
+	EventStartupTest  = "startup_test"
+	EventShutdown     = "shutdown"
+	EventResize       = "resize"
+	EventResizeFailed = "resize_failed"
+	// EventResizeSkipped is sent in alert-only mode instead of resizing,
+	// once until the usage goes back under the trigger.
+	EventResizeSkipped = "resize_skipped"
+	EventHealthy       = "healthy"
+	EventAlert         = "alert"
+	EventUsageAlert    = "usage_alert"
+	EventEmergency     = "emergency"
+	EventLimitReached  = "limit_reached"
+	EventNodeUpgrade   = "node_upgrade"
+	// EventPermissionMissing is sent at startup when the api credentials
+	// cannot resize the instance.
+	EventPermissionMissing = "permission_missing"
+)
+
+// Event is a notification sent to notifiers, a ResizeEvent or an AlertEvent.
+type Event interface {
+	// Type returns the event type, one of the Event constants.
+	Type() string
+}
+
+// ResizeEvent is the payload sent to notifiers.
+type ResizeEvent struct {
+	EventType       string    `json:"event_type"`
+	Time            time.Time `json:"time"`
+	Version         string    `json:"version"`
+	InstanceID      string    `json:"instance_id,omitempty"`
+	InstanceName    string    `json:"instance_name,omitempty"`
+	Region          string    `json:"region,omitempty"`
+	Engine          string    `json:"engine,omitempty"`
+	NodeType        string    `json:"node_type,omitempty"`
+	Message         string    `json:"message"`
+	OldSize         uint64    `json:"old_size,omitempty"`
+	NewSize         uint64    `json:"new_size,omitempty"`
+	UsagePercent    float64   `json:"usage_percent,omitempty"`
+	TriggeredBy     string    `json:"triggered_by,omitempty"`
+	SinceLastResize string    `json:"since_last_resize,omitempty"`
+	SnapshotID      string    `json:"snapshot_id,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+func NewResizeEvent(eventType string, instanceID string, message string) ResizeEvent {
+	return ResizeEvent{
+		EventType:  eventType,
+		Time:       time.Now(),
+		Version:    Version,
+		InstanceID: instanceID,
+		Message:    message,
+	}
+}
+
+func (e ResizeEvent) Type() string {
+	return e.EventType
+}
+
+// AlertEvent is the payload sent to notifiers when the checks of an
+// instance keep failing.
+type AlertEvent struct {
+	EventType    string    `json:"event_type"`
+	Time         time.Time `json:"time"`
+	Version      string    `json:"version"`
+	InstanceID   string    `json:"instance_id"`
+	Message      string    `json:"message"`
+	FailureCount int       `json:"failure_count"`
+	LastError    string    `json:"last_error"`
+}
+
+func NewAlertEvent(instanceID string, failureCount int, lastError error) AlertEvent {
+	return AlertEvent{
+		EventType:    EventAlert,
+		Time:         time.Now(),
+		Version:      Version,
+		InstanceID:   instanceID,
+		Message:      fmt.Sprintf("rdb autoresizer checks failed %d times in a row", failureCount),
+		FailureCount: failureCount,
+		LastError:    lastError.Error(),
+	}
+}
+
+func (e AlertEvent) Type() string {
+	return e.EventType
+}
+
+// Notifier delivers events to an external system.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// MultiNotifier sends events to all of its notifiers.
+type MultiNotifier []Notifier
+
+func (mn MultiNotifier) Notify(ctx context.Context, event Event) error {
+	var errs []error
+	for _, n := range mn {
+		if err := n.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WebhookNotifier posts events as JSON to an URL.
+type WebhookNotifier struct {
+	url       string
+	userAgent string
+	client    *http.Client
+}
+
+func NewWebhookNotifier(url string, userAgent string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:       url,
+		userAgent: userAgent,
+		client:    &http.Client{},
+	}
+}
+
+func (wn WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wn.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", wn.userAgent)
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// sendNotification sends event to notifier, logging delivery failures.
+func sendNotification(logger *slog.Logger, notifier Notifier, event Event, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := notifier.Notify(ctx, event); err != nil {
+		logger.Error(
+			"error sending notification",
+			slog.String("event_type", event.Type()),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// sendStartupTest sends a test notification, to make notifier misconfigurations
+// visible at startup rather than at the first resize. Failures are only
+// logged.
+func sendStartupTest(notifier Notifier, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	event := NewResizeEvent(EventStartupTest, "", "rdb autoresizer test notification, notifications are working")
+	if err := notifier.Notify(ctx, event); err != nil {
+		slog.Warn("error sending the test notification, check the notifier configuration", slog.Any("error", err))
+		return
+	}
+	slog.Info("test notification sent")
+}
+
+// notifyShutdown sends the shutdown notification. A nil reason means a
+// clean shutdown.
+func notifyShutdown(logger *slog.Logger, notifier Notifier, instanceID string, reason error, timeout time.Duration) {
+	event := NewResizeEvent(EventShutdown, instanceID, "rdb autoresizer stopped")
+	if reason != nil {
+		event.Message = "rdb autoresizer stopped on fatal error"
+		event.Error = reason.Error()
+	}
+	sendNotification(logger, notifier, event, timeout)
+}
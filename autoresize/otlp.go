@@ -0,0 +1,123 @@
+package autoresize
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// otlpExportInterval is the interval of the periodic reader. Metrics are
+// flushed after each iteration anyway, it only bounds the delay of those
+// recorded in between.
+const otlpExportInterval = time.Minute
+
+// otlpMetrics exports the main metrics to an otlp collector, alongside the
+// prometheus ones.
+type otlpMetrics struct {
+	provider         *sdkmetric.MeterProvider
+	timeout          time.Duration
+	diskUsagePercent metric.Float64Gauge
+	volumeSizeBytes  metric.Float64Gauge
+	resizeTotal      metric.Int64Counter
+}
+
+// newOTLPMetrics creates the exporter to the otlp grpc endpoint, such as
+// http://collector:4317. A plain http url disables tls.
+func newOTLPMetrics(ctx context.Context, endpoint string, timeout time.Duration) (*otlpMetrics, error) {
+	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpointURL(endpoint), otlpmetricgrpc.WithTimeout(timeout))
+	if err != nil {
+		return nil, fmt.Errorf("error creating otlp exporter: %w", err)
+	}
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(otlpExportInterval))),
+		sdkmetric.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "rdb-autoresize"),
+			attribute.String("service.version", Version),
+		)),
+	)
+	meter := provider.Meter("github.com/nlm/rdb-autoresize/autoresize")
+	m := &otlpMetrics{provider: provider, timeout: timeout}
+	if m.diskUsagePercent, err = meter.Float64Gauge(
+		"rdb_autoresize_disk_usage_percent",
+		metric.WithDescription("Disk usage of the instance volume, in percent."),
+		metric.WithUnit("%"),
+	); err != nil {
+		return nil, err
+	}
+	if m.volumeSizeBytes, err = meter.Float64Gauge(
+		"rdb_autoresize_volume_size_bytes",
+		metric.WithDescription("Size of the instance volume, in bytes."),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, err
+	}
+	if m.resizeTotal, err = meter.Int64Counter(
+		"rdb_autoresize_resize_total",
+		metric.WithDescription("Number of resize attempts, by result."),
+	); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *otlpMetrics) setDiskUsagePercent(instanceID, region string, value float64) {
+	if m == nil {
+		return
+	}
+	m.diskUsagePercent.Record(context.Background(), value, metric.WithAttributes(
+		attribute.String("instance_id", instanceID),
+		attribute.String("region", region),
+	))
+}
+
+func (m *otlpMetrics) setVolumeSizeBytes(instanceID, region string, value float64) {
+	if m == nil {
+		return
+	}
+	m.volumeSizeBytes.Record(context.Background(), value, metric.WithAttributes(
+		attribute.String("instance_id", instanceID),
+		attribute.String("region", region),
+	))
+}
+
+func (m *otlpMetrics) incResizeTotal(instanceID, region string, result string) {
+	if m == nil {
+		return
+	}
+	m.resizeTotal.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("instance_id", instanceID),
+		attribute.String("region", region),
+		attribute.String("result", result),
+	))
+}
+
+// Flush pushes the recorded metrics. Errors are only logged.
+func (m *otlpMetrics) Flush() {
+	if m == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	if err := m.provider.ForceFlush(ctx); err != nil {
+		slog.Warn("error exporting metrics over otlp", slog.Any("error", err))
+	}
+}
+
+// Shutdown flushes the metrics and stops the exporter.
+func (m *otlpMetrics) Shutdown() {
+	if m == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	if err := m.provider.Shutdown(ctx); err != nil {
+		slog.Warn("error stopping otlp exporter", slog.Any("error", err))
+	}
+}
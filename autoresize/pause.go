@@ -0,0 +1,25 @@
+package autoresize
+
+import (
+	"sync/atomic"
+)
+
+// Pause pauses and resumes the resizes of a Run, checks keep running but no
+// resize is done while paused. The zero value is not paused, and a nil Pause
+// is never paused.
+type Pause struct {
+	paused atomic.Bool
+}
+
+// Paused reports whether resizing is paused.
+func (p *Pause) Paused() bool {
+	if p == nil {
+		return false
+	}
+	return p.paused.Load()
+}
+
+// Set pauses or resumes resizing, and returns whether it was paused before.
+func (p *Pause) Set(paused bool) bool {
+	return p.paused.Swap(paused)
+}
@@ -0,0 +1,104 @@
+package autoresize
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// workerPool runs controller iterations on a fixed number of goroutines, to
+// bound the number of concurrent api calls when watching many instances.
+type workerPool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+}
+
+func newWorkerPool(workers int) *workerPool {
+	p := &workerPool{
+		jobs: make(chan func(), workers),
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range p.jobs {
+				job()
+				p.wg.Done()
+			}
+		}()
+	}
+	return p
+}
+
+// run iterates each of the controllers once, waits for all of them to
+// complete, and returns their errors joined.
+func (p *workerPool) run(ctx context.Context, controllers []*Controller) error {
+	errs := make([]error, len(controllers))
+	p.wg.Add(len(controllers))
+	for i, c := range controllers {
+		i, c := i, c
+		p.jobs <- func() { errs[i] = c.iterate(ctx) }
+	}
+	p.wg.Wait()
+	return errors.Join(errs...)
+}
+
+// close stops the workers.
+func (p *workerPool) close() {
+	close(p.jobs)
+}
+
+// dueControllers returns the controllers whose interval elapsed since their
+// last check, and schedules their next check. The control loop runs at the
+// shortest interval, instances with a longer one are skipped until due.
+func dueControllers(controllers []*Controller, now time.Time) []*Controller {
+	var due []*Controller
+	for _, c := range controllers {
+		if now.Before(c.nextCheck) {
+			continue
+		}
+		c.nextCheck = now.Add(c.opts.Interval)
+		due = append(due, c)
+	}
+	return due
+}
+
+// staggerFirstChecks spreads the first checks of the controllers over delay
+// from now, in the order of their instance ids, the last one being due after
+// the full delay. It returns the due times, in chronological order.
+func staggerFirstChecks(controllers []*Controller, now time.Time, delay time.Duration) []time.Time {
+	sorted := slices.Clone(controllers)
+	slices.SortFunc(sorted, func(a, b *Controller) int {
+		return strings.Compare(a.InstanceID(), b.InstanceID())
+	})
+	starts := make([]time.Time, 0, len(sorted))
+	for i, c := range sorted {
+		c.nextCheck = now.Add(delay * time.Duration(i+1) / time.Duration(len(sorted)))
+		starts = append(starts, c.nextCheck)
+	}
+	return starts
+}
+
+// shortestInterval returns the shortest check interval of the controllers.
+func shortestInterval(controllers []*Controller) time.Duration {
+	interval := controllers[0].opts.Interval
+	for _, c := range controllers[1:] {
+		interval = min(interval, c.opts.Interval)
+	}
+	return interval
+}
+
+// resizeLimit returns the rate limit allowing perInterval resizes per check
+// interval.
+func resizeLimit(perInterval float64, interval time.Duration) rate.Limit {
+	return rate.Limit(perInterval / interval.Seconds())
+}
+
+// resizeBurst returns the burst allowing perInterval resizes at once.
+func resizeBurst(perInterval float64) int {
+	return max(int(math.Ceil(perInterval)), 1)
+}
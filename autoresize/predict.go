@@ -0,0 +1,51 @@
+package autoresize
+
+import (
+	"time"
+)
+
+// predictionSamples is the number of usage samples kept for predictions.
+const predictionSamples = 12
+
+type usageSample struct {
+	time  time.Time
+	value float64
+}
+
+// usageHistory keeps the most recent disk usage samples, to extrapolate
+// future usage.
+type usageHistory struct {
+	samples []usageSample
+}
+
+func (h *usageHistory) add(t time.Time, value float64) {
+	h.samples = append(h.samples, usageSample{time: t, value: value})
+	if len(h.samples) > predictionSamples {
+		h.samples = h.samples[len(h.samples)-predictionSamples:]
+	}
+}
+
+// predict extrapolates the usage at t using a linear regression over the
+// samples. It returns false when there is not enough data.
+func (h *usageHistory) predict(t time.Time) (float64, bool) {
+	if len(h.samples) < 3 {
+		return 0, false
+	}
+	origin := h.samples[0].time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range h.samples {
+		x := s.time.Sub(origin).Hours()
+		sumX += x
+		sumY += s.value
+		sumXY += x * s.value
+		sumXX += x * x
+	}
+	n := float64(len(h.samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+	return intercept + slope*t.Sub(origin).Hours(), true
+}
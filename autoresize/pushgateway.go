@@ -0,0 +1,92 @@
+package autoresize
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// pushgatewayJob is the job name metrics are pushed under.
+const pushgatewayJob = "rdb_autoresize"
+
+// pushgateway pushes the metrics to a prometheus pushgateway, for
+// environments where the process cannot be scraped.
+type pushgateway struct {
+	pusher  *push.Pusher
+	timeout time.Duration
+}
+
+func newPushgateway(addr, instanceID string, timeout time.Duration) *pushgateway {
+	return &pushgateway{
+		pusher: push.New(addr, pushgatewayJob).
+			Gatherer(instanceGatherer{instanceID: instanceID}).
+			Grouping("instance_id", instanceID),
+		timeout: timeout,
+	}
+}
+
+// instanceGatherer gathers the default registry metrics of one instance. Their
+// instance_id label is removed, as the pushgateway rejects metrics carrying
+// a grouping label and sets it from the grouping key instead.
+type instanceGatherer struct {
+	instanceID string
+}
+
+func (g instanceGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	var result []*dto.MetricFamily
+	for _, mf := range mfs {
+		var metrics []*dto.Metric
+		for _, m := range mf.GetMetric() {
+			labels := make([]*dto.LabelPair, 0, len(m.GetLabel()))
+			keep := true
+			for _, l := range m.GetLabel() {
+				if l.GetName() != "instance_id" {
+					labels = append(labels, l)
+					continue
+				}
+				keep = l.GetValue() == g.instanceID
+			}
+			if keep {
+				m.Label = labels
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) > 0 {
+			mf.Metric = metrics
+			result = append(result, mf)
+		}
+	}
+	return result, nil
+}
+
+// Push replaces the metrics of the instance on the pushgateway. Errors are
+// only logged.
+func (p *pushgateway) Push(logger *slog.Logger) {
+	if p == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	if err := p.pusher.PushContext(ctx); err != nil {
+		logger.Warn("error pushing metrics to pushgateway", slog.Any("error", err))
+	}
+}
+
+// Delete removes the metrics of the instance from the pushgateway. Errors
+// are only logged.
+func (p *pushgateway) Delete(logger *slog.Logger) {
+	if p == nil {
+		return
+	}
+	if err := p.pusher.Delete(); err != nil {
+		logger.Warn("error deleting metrics from pushgateway", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,530 @@
+package autoresize
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// ErrNoMetricData is returned when the metrics API answered but had no data
+// point to offer, which happens briefly after instance operations.
+var ErrNoMetricData = errors.New("no metric data available")
+
+// ErrStaleMetric is returned when the most recent data point of a metric is
+// older than the maximum metric age, acting on it could trigger a resize
+// that is not needed anymore.
+var ErrStaleMetric = errors.New("metric data point is stale")
+
+// DefaultMaxMetricAge is the default maximum age of the disk usage data
+// points, see SetMaxMetricAge.
+const DefaultMaxMetricAge = 10 * time.Minute
+
+func NewAutoResizer(client *scw.Client, region, instance string) *AutoResizer {
+	projectID, _ := client.GetDefaultProjectID()
+	return &AutoResizer{
+		client:       client,
+		rdbApi:       rdb.NewAPI(client),
+		region:       scw.Region(region),
+		instanceID:   instance,
+		projectID:    projectID,
+		maxMetricAge: DefaultMaxMetricAge,
+	}
+}
+
+type AutoResizer struct {
+	// client runs the raw requests, see RawInstance and RawMetrics.
+	client     *scw.Client
+	rdbApi     *rdb.API
+	region     scw.Region
+	instanceID string
+	// projectID is the project the instance is expected to belong to, if
+	// configured.
+	projectID string
+	// maxMetricAge is the age past which disk usage data points are
+	// stale, 0 to accept any.
+	maxMetricAge time.Duration
+	// usageWindow is the range of the disk usage data points aggregated
+	// with usageAggregation, 0 to use the most recent point only.
+	usageWindow      time.Duration
+	usageAggregation string
+}
+
+// Aggregations of the disk usage data points over the usage window.
+const (
+	AggregationLast = "last"
+	AggregationMax  = "max"
+	AggregationAvg  = "avg"
+)
+
+// SetUsageAggregation makes GetDiskUsagePercent query the disk usage over
+// the last window and aggregate the data points, such as taking their
+// maximum, which is more conservative than the latest one. A zero window
+// uses the most recent point only.
+func (as *AutoResizer) SetUsageAggregation(window time.Duration, aggregation string) error {
+	switch aggregation {
+	case AggregationLast, AggregationMax, AggregationAvg:
+	default:
+		return fmt.Errorf("invalid aggregation '%s', must be last, max or avg", aggregation)
+	}
+	as.usageWindow = window
+	as.usageAggregation = aggregation
+	return nil
+}
+
+// SetMaxMetricAge sets the age past which GetDiskUsagePercent rejects data
+// points with ErrStaleMetric, 0 to accept any.
+func (as *AutoResizer) SetMaxMetricAge(maxAge time.Duration) {
+	as.maxMetricAge = maxAge
+}
+
+func (as AutoResizer) InstanceID() string {
+	return as.instanceID
+}
+
+func (as AutoResizer) Region() string {
+	return as.region.String()
+}
+
+func (as AutoResizer) GetInstance(ctx context.Context) (*rdb.Instance, error) {
+	return as.rdbApi.GetInstance(&rdb.GetInstanceRequest{
+		Region:     as.region,
+		InstanceID: as.instanceID,
+	}, scw.WithContext(ctx))
+}
+
+// RawInstance returns the response of the GetInstance api call as is, for
+// diagnostics.
+func (as AutoResizer) RawInstance(ctx context.Context) (json.RawMessage, error) {
+	return as.rawRequest(ctx, "/instances/"+as.instanceID, nil)
+}
+
+// RawMetrics returns the response of the instance metrics api call as is,
+// for diagnostics. All the metrics are returned when metricName is empty.
+func (as AutoResizer) RawMetrics(ctx context.Context, metricName string) (json.RawMessage, error) {
+	query := url.Values{}
+	if metricName != "" {
+		query.Set("metric_name", metricName)
+	}
+	return as.rawRequest(ctx, "/instances/"+as.instanceID+"/metrics", query)
+}
+
+// rawRequest runs a GET request on the rdb api path of the region, leaving
+// the json response undecoded.
+func (as AutoResizer) rawRequest(ctx context.Context, path string, query url.Values) (json.RawMessage, error) {
+	var resp json.RawMessage
+	err := as.client.Do(&scw.ScalewayRequest{
+		Method:  http.MethodGet,
+		Path:    "/rdb/v1/regions/" + as.region.String() + path,
+		Query:   query,
+		Headers: http.Header{},
+	}, &resp, scw.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// IsInstanceSettling reports whether status is a transient status the
+// instance will leave on its own, such as during an upgrade.
+func IsInstanceSettling(status rdb.InstanceStatus) bool {
+	switch status {
+	case rdb.InstanceStatusProvisioning,
+		rdb.InstanceStatusConfiguring,
+		rdb.InstanceStatusInitializing,
+		rdb.InstanceStatusAutohealing,
+		rdb.InstanceStatusBackuping,
+		rdb.InstanceStatusSnapshotting,
+		rdb.InstanceStatusRestarting:
+		return true
+	}
+	return false
+}
+
+// BackupInProgress reports whether a backup of the instance is running: the
+// instance is in the backuping status, or one of its recent logical backups
+// is being created or exported.
+func (as AutoResizer) BackupInProgress(ctx context.Context, instance *rdb.Instance) (bool, error) {
+	if instance.Status == rdb.InstanceStatusBackuping {
+		return true, nil
+	}
+	pageSize := uint32(10)
+	backups, err := as.rdbApi.ListDatabaseBackups(&rdb.ListDatabaseBackupsRequest{
+		Region:     as.region,
+		InstanceID: &as.instanceID,
+		OrderBy:    rdb.ListDatabaseBackupsRequestOrderByCreatedAtDesc,
+		PageSize:   &pageSize,
+	}, scw.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	for _, backup := range backups.DatabaseBackups {
+		switch backup.Status {
+		case rdb.DatabaseBackupStatusCreating, rdb.DatabaseBackupStatusExporting:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// WaitForInstance waits for the instance to leave transient statuses, for at
+// most timeout.
+func (as AutoResizer) WaitForInstance(ctx context.Context, timeout time.Duration) (*rdb.Instance, error) {
+	return as.rdbApi.WaitForInstance(&rdb.WaitForInstanceRequest{
+		Region:     as.region,
+		InstanceID: as.instanceID,
+		Timeout:    &timeout,
+	}, scw.WithContext(ctx))
+}
+
+// ResizeVolume grows the volume of the instance to newSize, once checked
+// that the instance is ready. The resize is not requested if ctx is done
+// by then.
+func (as AutoResizer) ResizeVolume(ctx context.Context, newSize uint64) (*rdb.Instance, error) {
+	instance, err := as.GetInstance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if instance.Status != rdb.InstanceStatusReady && instance.Status != rdb.InstanceStatusDiskFull {
+		return nil, fmt.Errorf("instance is not in a ready state: %s", instance.Status)
+	}
+	return as.rdbApi.UpgradeInstance(&rdb.UpgradeInstanceRequest{
+		Region:     as.region,
+		InstanceID: as.instanceID,
+		VolumeSize: &newSize,
+	}, scw.WithContext(ctx))
+}
+
+// ResizeVolumeWait resizes the volume like ResizeVolume, then polls the
+// instance every pollInterval until it is ready again.
+func (as AutoResizer) ResizeVolumeWait(ctx context.Context, newSize uint64, pollInterval time.Duration) (*rdb.Instance, error) {
+	instance, err := as.ResizeVolume(ctx, newSize)
+	if err != nil {
+		return instance, err
+	}
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return instance, fmt.Errorf("error waiting for the resize to complete: %w", ctx.Err())
+		case <-t.C:
+		}
+		instance, err = as.GetInstance(ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case instance.Status == rdb.InstanceStatusReady:
+			return instance, nil
+		case instance.Status == rdb.InstanceStatusError || instance.Status == rdb.InstanceStatusLocked:
+			return instance, fmt.Errorf("instance is in %s state after resize", instance.Status)
+		}
+	}
+}
+
+// CreateSnapshotWait creates a snapshot of the instance named name, then
+// polls it every pollInterval until it is ready.
+func (as AutoResizer) CreateSnapshotWait(ctx context.Context, name string, pollInterval time.Duration) (*rdb.Snapshot, error) {
+	snapshot, err := as.rdbApi.CreateSnapshot(&rdb.CreateSnapshotRequest{
+		Region:     as.region,
+		InstanceID: as.instanceID,
+		Name:       name,
+	}, scw.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	t := time.NewTicker(pollInterval)
+	defer t.Stop()
+	for {
+		switch snapshot.Status {
+		case rdb.SnapshotStatusReady:
+			return snapshot, nil
+		case rdb.SnapshotStatusError, rdb.SnapshotStatusLocked:
+			return snapshot, fmt.Errorf("snapshot %s is in %s state", snapshot.ID, snapshot.Status)
+		}
+		select {
+		case <-ctx.Done():
+			return snapshot, fmt.Errorf("error waiting for snapshot %s: %w", snapshot.ID, ctx.Err())
+		case <-t.C:
+		}
+		id := snapshot.ID
+		snapshot, err = as.rdbApi.GetSnapshot(&rdb.GetSnapshotRequest{
+			Region:     as.region,
+			SnapshotID: id,
+		}, scw.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("error getting snapshot %s: %w", id, err)
+		}
+	}
+}
+
+// UpgradeNodeType upgrades the instance to nodeType.
+func (as AutoResizer) UpgradeNodeType(ctx context.Context, nodeType string) (*rdb.Instance, error) {
+	instance, err := as.GetInstance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if instance.Status != rdb.InstanceStatusReady {
+		return nil, fmt.Errorf("instance is not in a ready state: %s", instance.Status)
+	}
+	return as.rdbApi.UpgradeInstance(&rdb.UpgradeInstanceRequest{
+		Region:     as.region,
+		InstanceID: as.instanceID,
+		NodeType:   &nodeType,
+	}, scw.WithContext(ctx))
+}
+
+// GetMaxVolumeSize returns the maximum volume size supported by the node
+// type and volume type of instance.
+func (as AutoResizer) GetMaxVolumeSize(ctx context.Context, instance *rdb.Instance) (uint64, error) {
+	_, maxSize, err := as.volumeSizeRange(ctx, instance)
+	if err == nil && maxSize == 0 {
+		err = fmt.Errorf("no volume size constraint for node type: %s", instance.NodeType)
+	}
+	return maxSize, err
+}
+
+// GetMinVolumeSize returns the minimum volume size supported by the node
+// type and volume type of instance, 0 if it has none.
+func (as AutoResizer) GetMinVolumeSize(ctx context.Context, instance *rdb.Instance) (uint64, error) {
+	minSize, _, err := as.volumeSizeRange(ctx, instance)
+	return minSize, err
+}
+
+// volumeSizeRange returns the volume size range of the node type and volume
+// type of instance, the bounds being 0 when unknown.
+func (as AutoResizer) volumeSizeRange(ctx context.Context, instance *rdb.Instance) (minSize, maxSize uint64, err error) {
+	nodeTypes, err := as.rdbApi.ListNodeTypes(&rdb.ListNodeTypesRequest{
+		Region:               as.region,
+		IncludeDisabledTypes: true,
+	}, scw.WithAllPages(), scw.WithContext(ctx))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, nodeType := range nodeTypes.NodeTypes {
+		if !strings.EqualFold(nodeType.Name, instance.NodeType) {
+			continue
+		}
+		for _, volumeType := range nodeType.AvailableVolumeTypes {
+			if volumeType.Type == instance.Volume.Type && volumeType.MaxSize > 0 {
+				return uint64(volumeType.MinSize), uint64(volumeType.MaxSize), nil
+			}
+		}
+		if nodeType.VolumeConstraint != nil {
+			return uint64(nodeType.VolumeConstraint.MinSize), uint64(nodeType.VolumeConstraint.MaxSize), nil
+		}
+		return 0, 0, nil
+	}
+	return 0, 0, fmt.Errorf("node type not found: %s", instance.NodeType)
+}
+
+// GetMetric returns the most recent value of the named instance metric, such
+// as disk_usage_percent or cpu_usage_percent.
+func (as AutoResizer) GetMetric(ctx context.Context, metricName string) (float64, error) {
+	point, err := as.getMetricPoint(ctx, metricName)
+	return point.Value, err
+}
+
+// getMetricPoint returns the most recent data point of the named instance
+// metric.
+func (as AutoResizer) getMetricPoint(ctx context.Context, metricName string) (MetricPoint, error) {
+	metrics, err := as.rdbApi.GetInstanceMetrics(&rdb.GetInstanceMetricsRequest{
+		Region:     as.region,
+		InstanceID: as.instanceID,
+		MetricName: &metricName,
+	}, scw.WithContext(ctx))
+	if err != nil {
+		return MetricPoint{}, err
+	}
+	if len(metrics.Timeseries) > 1 {
+		return MetricPoint{}, fmt.Errorf("malformed output")
+	}
+	if len(metrics.Timeseries) == 0 || len(metrics.Timeseries[0].Points) == 0 {
+		return MetricPoint{}, ErrNoMetricData
+	}
+	points := metrics.Timeseries[0].Points
+	last := points[len(points)-1]
+	return MetricPoint{Timestamp: last.Timestamp, Value: float64(last.Value)}, nil
+}
+
+// MetricPoint is a single value of an instance metric.
+type MetricPoint struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// GetMetricHistory returns the values of the named instance metric between
+// start and end, in chronological order.
+func (as AutoResizer) GetMetricHistory(ctx context.Context, metricName string, start, end time.Time) ([]MetricPoint, error) {
+	metrics, err := as.rdbApi.GetInstanceMetrics(&rdb.GetInstanceMetricsRequest{
+		Region:     as.region,
+		InstanceID: as.instanceID,
+		StartDate:  &start,
+		EndDate:    &end,
+		MetricName: &metricName,
+	}, scw.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if len(metrics.Timeseries) > 1 {
+		return nil, fmt.Errorf("malformed output")
+	}
+	if len(metrics.Timeseries) == 0 || len(metrics.Timeseries[0].Points) == 0 {
+		return nil, ErrNoMetricData
+	}
+	points := make([]MetricPoint, 0, len(metrics.Timeseries[0].Points))
+	for _, point := range metrics.Timeseries[0].Points {
+		points = append(points, MetricPoint{
+			Timestamp: point.Timestamp,
+			Value:     float64(point.Value),
+		})
+	}
+	slices.SortFunc(points, func(a, b MetricPoint) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	return points, nil
+}
+
+// GetDiskUsagePercent returns the most recent disk usage percentage of the
+// instance, or its aggregation over the usage window, and the time of the
+// most recent data point. It fails with ErrStaleMetric when that point is
+// older than the maximum metric age.
+func (as AutoResizer) GetDiskUsagePercent(ctx context.Context) (float64, time.Time, error) {
+	point, err := as.getDiskUsagePoint(ctx)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	age := time.Since(point.Timestamp)
+	slog.Debug(
+		"disk usage data point",
+		slog.String("instance_id", as.instanceID),
+		slog.Time("timestamp", point.Timestamp),
+		slog.Duration("age", age.Round(time.Second)),
+	)
+	if as.maxMetricAge > 0 && age > as.maxMetricAge {
+		return point.Value, point.Timestamp, fmt.Errorf("%w: data point is %s old, over %s", ErrStaleMetric, age.Round(time.Second), as.maxMetricAge)
+	}
+	return point.Value, point.Timestamp, nil
+}
+
+// getDiskUsagePoint returns the disk usage data point, aggregated over the
+// usage window if set. The timestamp is the one of the most recent point.
+func (as AutoResizer) getDiskUsagePoint(ctx context.Context) (MetricPoint, error) {
+	if as.usageWindow == 0 {
+		return as.getMetricPoint(ctx, "disk_usage_percent")
+	}
+	end := time.Now()
+	points, err := as.GetMetricHistory(ctx, "disk_usage_percent", end.Add(-as.usageWindow), end)
+	if err != nil {
+		return MetricPoint{}, err
+	}
+	result := points[len(points)-1]
+	switch as.usageAggregation {
+	case AggregationMax:
+		for _, point := range points {
+			result.Value = max(result.Value, point.Value)
+		}
+	case AggregationAvg:
+		var sum float64
+		for _, point := range points {
+			sum += point.Value
+		}
+		result.Value = sum / float64(len(points))
+	}
+	slog.Debug(
+		"disk usage aggregated",
+		slog.String("instance_id", as.instanceID),
+		slog.String("aggregation", as.usageAggregation),
+		slog.Int("points", len(points)),
+		slog.Float64("value", result.Value),
+	)
+	return result, nil
+}
+
+// GetDiskIOPSPercent returns the disk write IOPS as a percentage of the
+// maximum IOPS of the volume.
+func (as AutoResizer) GetDiskIOPSPercent(ctx context.Context) (float64, error) {
+	iopsWrite, err := as.GetMetric(ctx, "disk_iops_write")
+	if err != nil {
+		return 0, err
+	}
+	iopsMax, err := as.GetMetric(ctx, "disk_iops_max")
+	if err != nil {
+		return 0, err
+	}
+	if iopsMax == 0 {
+		return 0, fmt.Errorf("maximum disk iops is zero")
+	}
+	return iopsWrite / iopsMax * 100, nil
+}
+
+// GetDiskUsageBytes returns the used and total bytes of the instance disk.
+// When the byte metrics are not available, they are computed from the usage
+// percentage and the volume size.
+func (as AutoResizer) GetDiskUsageBytes(ctx context.Context) (usedBytes, totalBytes uint64, err error) {
+	used, errUsed := as.GetMetric(ctx, "disk_used_bytes")
+	total, errTotal := as.GetMetric(ctx, "disk_total_effective_bytes")
+	if errUsed == nil && errTotal == nil {
+		return uint64(used), uint64(total), nil
+	}
+	// do not fall back to more calls when the metrics failed on ctx
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	instance, err := as.GetInstance(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	percent, _, err := as.GetDiskUsagePercent(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	totalBytes = uint64(instance.Volume.Size)
+	return uint64(percent / 100 * float64(totalBytes)), totalBytes, nil
+}
+
+// SupportsVolumeType reports whether the node type of instance supports
+// volumeType.
+func (as AutoResizer) SupportsVolumeType(ctx context.Context, instance *rdb.Instance, volumeType rdb.VolumeType) (bool, error) {
+	nodeTypes, err := as.rdbApi.ListNodeTypes(&rdb.ListNodeTypesRequest{
+		Region:               as.region,
+		IncludeDisabledTypes: true,
+	}, scw.WithAllPages(), scw.WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	for _, nodeType := range nodeTypes.NodeTypes {
+		if !strings.EqualFold(nodeType.Name, instance.NodeType) {
+			continue
+		}
+		return slices.ContainsFunc(nodeType.AvailableVolumeTypes, func(vt *rdb.NodeTypeVolumeType) bool {
+			return vt.Type == volumeType
+		}), nil
+	}
+	return false, fmt.Errorf("node type not found: %s", instance.NodeType)
+}
+
+// MigrateVolumeType changes the volume type of the instance.
+func (as AutoResizer) MigrateVolumeType(ctx context.Context, volumeType rdb.VolumeType) (*rdb.Instance, error) {
+	return as.rdbApi.UpgradeInstance(&rdb.UpgradeInstanceRequest{
+		Region:     as.region,
+		InstanceID: as.instanceID,
+		VolumeType: &volumeType,
+	}, scw.WithContext(ctx))
+}
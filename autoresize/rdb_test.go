@@ -0,0 +1,60 @@
+package autoresize
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+func TestGetMetricNoData(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics rdb.InstanceMetrics
+	}{
+		{
+			name:    "no timeseries",
+			metrics: rdb.InstanceMetrics{Timeseries: []*scw.TimeSeries{}},
+		},
+		{
+			name: "empty points",
+			metrics: rdb.InstanceMetrics{Timeseries: []*scw.TimeSeries{{
+				Name:   "disk_usage_percent",
+				Points: []*scw.TimeSeriesPoint{},
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ar := newFakeRDB(t)
+			f.metrics = tt.metrics
+			value, err := ar.GetMetric(context.Background(), "disk_usage_percent")
+			if !errors.Is(err, ErrNoMetricData) {
+				t.Fatalf("GetMetric() error = %v, want %v", err, ErrNoMetricData)
+			}
+			if value != 0 {
+				t.Fatalf("GetMetric() = %v, want 0", value)
+			}
+			if _, _, err := ar.GetDiskUsagePercent(context.Background()); !errors.Is(err, ErrNoMetricData) {
+				t.Fatalf("GetDiskUsagePercent() error = %v, want %v", err, ErrNoMetricData)
+			}
+		})
+	}
+}
+
+func TestResizeVolumeCanceled(t *testing.T) {
+	f, ar := newFakeRDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// cancel during the pre-check, before the upgrade
+	f.onGetInstance = cancel
+	_, err := ar.ResizeVolume(ctx, 60_000_000_000)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ResizeVolume() error = %v, want %v", err, context.Canceled)
+	}
+	if upgrades := f.upgradeRequests(); len(upgrades) != 0 {
+		t.Fatalf("got %d upgrade requests, want none", len(upgrades))
+	}
+}
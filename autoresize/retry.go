@@ -0,0 +1,148 @@
+package autoresize
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// permanentError marks an error that retrying cannot fix, such as a
+// configuration error.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// permanent marks err as not worth retrying.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// isPermanent reports whether retrying after err is pointless: it was marked
+// permanent, or the api rejected the credentials or does not know the
+// resource.
+func isPermanent(err error) bool {
+	var permErr permanentError
+	if errors.As(err, &permErr) {
+		return true
+	}
+	var notFoundErr *scw.ResourceNotFoundError
+	return errors.As(err, &notFoundErr) || IsAuthError(err)
+}
+
+// Backoff is the exponential backoff policy of the retrying call sites: the
+// delay after the nth consecutive failure is Base × Multiplier^(n-1), capped
+// to Max, randomly varied by up to Jitter of itself. Zero fields take the
+// value of DefaultBackoff.
+type Backoff struct {
+	Base       time.Duration
+	Multiplier float64
+	Max        time.Duration
+	// Attempts is the maximum number of attempts, including the first one.
+	Attempts int
+	// Jitter is the fraction of the delay it is randomly varied by.
+	Jitter float64
+	// Rand returns the jitter randomness in [0, 1), and After waits for a
+	// delay, for tests to inject a deterministic clock. They default to
+	// math/rand and time.After.
+	Rand  func() float64
+	After func(time.Duration) <-chan time.Time
+}
+
+// DefaultBackoff is the backoff policy used when none is configured.
+var DefaultBackoff = Backoff{
+	Base:       5 * time.Second,
+	Multiplier: 2,
+	Max:        time.Minute,
+	Attempts:   5,
+	Jitter:     0.2,
+}
+
+// WithDefaults returns b with its zero fields set from DefaultBackoff.
+func (b Backoff) WithDefaults() Backoff {
+	if b.Base <= 0 {
+		b.Base = DefaultBackoff.Base
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = DefaultBackoff.Multiplier
+	}
+	if b.Max <= 0 {
+		b.Max = DefaultBackoff.Max
+	}
+	if b.Attempts <= 0 {
+		b.Attempts = DefaultBackoff.Attempts
+	}
+	if b.Jitter < 0 || b.Jitter > 1 {
+		b.Jitter = DefaultBackoff.Jitter
+	}
+	if b.Rand == nil {
+		b.Rand = rand.Float64
+	}
+	if b.After == nil {
+		b.After = time.After
+	}
+	return b
+}
+
+// Delay returns the delay to wait after the given number of consecutive
+// failures.
+func (b Backoff) Delay(failures int) time.Duration {
+	b = b.WithDefaults()
+	delay := float64(b.Base)
+	for i := 1; i < failures && delay < float64(b.Max); i++ {
+		delay *= b.Multiplier
+	}
+	delay = min(delay, float64(b.Max))
+	delay += delay * b.Jitter * (2*b.Rand() - 1)
+	return min(time.Duration(delay), b.Max)
+}
+
+// Sleep waits for delay, or until ctx is done.
+func (b Backoff) Sleep(ctx context.Context, delay time.Duration) error {
+	b = b.WithDefaults()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.After(delay):
+		return nil
+	}
+}
+
+// retry calls fn until it succeeds, fails with a permanent error, has been
+// called b.Attempts times, or ctx is done. The delay between attempts
+// follows b.
+func retry(ctx context.Context, logger *slog.Logger, b Backoff, fn func() error) error {
+	b = b.WithDefaults()
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || isPermanent(err) || attempt >= b.Attempts {
+			return err
+		}
+		delay := b.Delay(attempt)
+		logger.Warn(
+			"attempt failed, retrying",
+			slog.Int("attempt", attempt),
+			slog.Int("attempts", b.Attempts),
+			slog.Duration("delay", delay),
+			slog.Any("error", err),
+		)
+		if err := b.Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
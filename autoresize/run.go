@@ -0,0 +1,590 @@
+// Package autoresize watches the disk usage of scaleway managed database
+// instances, and grows their volume before it fills up.
+//
+// Run is the entry point, the rdb-autoresize command being a thin wrapper
+// parsing flags into a Config:
+//
+//	client, err := scw.NewClient(scw.WithEnv())
+//	...
+//	err = autoresize.Run(ctx, autoresize.Config{
+//		Instances: []*autoresize.AutoResizer{
+//			autoresize.NewAutoResizer(client, "fr-par", instanceID),
+//		},
+//		Settings: &autoresize.Settings{
+//			TriggerPercent: 90,
+//			SizeLimits:     []int64{500 * units.GB},
+//			Increment:      autoresize.DefaultIncrement,
+//			Interval:       autoresize.DefaultInterval,
+//		},
+//	})
+package autoresize
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/prometheus/client_golang/prometheus"
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+	"golang.org/x/time/rate"
+)
+
+// Defaults of the settings.
+const (
+	DefaultIncrement = uint64(5 * units.GB)
+	DefaultInterval  = 5 * time.Minute
+)
+
+var (
+	// resizePollDelay is the delay between instance polls while waiting
+	// for a resize to complete.
+	resizePollDelay   = 10 * time.Second
+	maxDefaultWorkers = 10
+)
+
+// Version is reported in notifications and the user agent, it is set at
+// build time.
+var Version = "dev"
+
+// DefaultUserAgent returns the default user agent of the http requests, with
+// the version and build details.
+func DefaultUserAgent() string {
+	return fmt.Sprintf("RDBAutoResize/%s (%s; %s/%s)", Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// Permission is the outcome of a permission check of the api credentials.
+type Permission int
+
+const (
+	// PermissionUnknown is used when the permission could not be checked.
+	PermissionUnknown Permission = iota
+	PermissionGranted
+	PermissionMissing
+)
+
+// Config configures Run. Settings and Instances are required, the zero
+// value of the other fields disables the feature or uses its default.
+type Config struct {
+	// Instances are the instances to watch.
+	Instances []*AutoResizer
+	// Settings drive the resizes, see Settings.ForInstance.
+	Settings *Settings
+	// Notifier receives the events, none are sent if nil.
+	Notifier Notifier
+	// QueryTimeout is the timeout of read operations, 1m by default.
+	QueryTimeout time.Duration
+	// ResizeTimeout is the timeout of resize operations, 20m by default.
+	ResizeTimeout time.Duration
+	// MaxResizeBackoff is the maximum delay between resize attempts after
+	// failures, 2h by default.
+	MaxResizeBackoff time.Duration
+	// AlertAfterFailures is the number of consecutive failed checks after
+	// which an alert is sent.
+	AlertAfterFailures int
+	// MaxConsecutiveErrors, when set, is the number of consecutive failed
+	// checks of an instance past which Run stops with ErrTooManyErrors.
+	MaxConsecutiveErrors int
+	// Backoff is the retry policy of the instance pre-checks, and of
+	// resizes with the loop interval as base delay and MaxResizeBackoff as
+	// maximum. Zero fields take the value of DefaultBackoff.
+	Backoff Backoff
+	// Workers is the number of instances checked concurrently, defaults to
+	// the number of instances up to 10.
+	Workers int
+	// ResizeRate is the maximum number of resizes of an instance per check
+	// interval, resizes over it are skipped until the next interval.
+	ResizeRate float64
+	// NotifyOnHealthy sends a notification when usage is back to healthy
+	// levels after a resize.
+	NotifyOnHealthy bool
+	// RecheckBeforeResize checks the disk usage again right before
+	// resizing, and aborts if it dropped under the trigger.
+	RecheckBeforeResize bool
+	// CollectUsageBytes fetches the used and total bytes of the disk on
+	// each check, for the metrics.
+	CollectUsageBytes bool
+	// ExitOnLimit stops Run with ErrLimitReached when an instance needs a
+	// resize over the size limit, or is already at it at startup.
+	// Otherwise, the instance enters the limit reached state, which is
+	// notified, and is still monitored.
+	ExitOnLimit bool
+	// Once runs a single check, waiting for resizes to complete, then
+	// returns.
+	Once bool
+	// InitialDelay delays the first checks, which are spread over it in the
+	// order of the instance ids, the last instance being checked after the
+	// full delay.
+	InitialDelay time.Duration
+	// StartupGrace is the time after the pre-checks during which resizes
+	// are deferred, the usage still being checked and notified, for an
+	// operator to intervene when starting during high usage.
+	StartupGrace time.Duration
+	// PreResizeCmd and PostResizeCmd are shell commands run around resizes,
+	// a pre-resize failure aborts the resize.
+	PreResizeCmd  string
+	PostResizeCmd string
+	// AlertOnly runs every check and notification, but never resizes, a
+	// resize_skipped notification being sent instead. It works with
+	// read-only credentials.
+	AlertOnly bool
+	// NotifyStartupTest sends a startup_test notification once the
+	// pre-checks passed, to verify the notifiers at deploy time.
+	NotifyStartupTest bool
+	// ResizePermission is whether the api credentials are allowed to
+	// resize the instances, as checked by the caller. It is exposed as a
+	// metric, and a missing permission is notified at startup.
+	ResizePermission Permission
+	// Pause pauses and resumes the resizes, they are never paused if nil.
+	Pause *Pause
+	// UserAgent is the user agent of the http requests of the heartbeat,
+	// DefaultUserAgent() by default.
+	UserAgent string
+	// SkipResizeOnBackup defers resizes while a backup of the instance is
+	// running, instead of waiting for it to complete.
+	SkipResizeOnBackup bool
+	// SnapshotBeforeResize creates a snapshot of the instance before each
+	// resize, which is skipped if the snapshot is not ready within
+	// SnapshotTimeout, 30m by default.
+	SnapshotBeforeResize bool
+	SnapshotTimeout      time.Duration
+	// HeartbeatURL is pinged after each poll, suffixed with /fail on errors.
+	HeartbeatURL string
+	// PushgatewayAddr is a prometheus pushgateway the metrics are pushed to.
+	PushgatewayAddr string
+	// OTLPMetricsEndpoint is the url of an otlp grpc collector the main
+	// metrics are exported to after each iteration, such as
+	// http://collector:4317.
+	OTLPMetricsEndpoint string
+	// MetricsFile is written with the metrics after each check, for the
+	// node-exporter textfile collector.
+	MetricsFile string
+	// HistoryFile records the resize events as JSON Lines, the resize
+	// history, count and last resize time being restored from it at
+	// startup.
+	HistoryFile string
+	// StatsdAddr is the host:port of a statsd server the metrics are sent
+	// to over udp after each iteration, in the StatsdFormat format,
+	// StatsdFormatStatsd by default.
+	StatsdAddr   string
+	StatsdFormat string
+	// Reloads receives settings replacing the current ones.
+	Reloads <-chan *Settings
+	// Evaluate receives requests for an immediate check of all the
+	// instances, outside of the loop schedule, which is left unchanged.
+	Evaluate <-chan struct{}
+	// Started is called with the controllers once the pre-checks passed,
+	// before entering the control loop, to expose their status. It is not
+	// called with Once, and an error stops Run.
+	Started func(controllers []*Controller) error
+}
+
+// setDefaults fills the unset fields of cfg with their default value.
+func (cfg *Config) setDefaults() {
+	if cfg.Notifier == nil {
+		cfg.Notifier = MultiNotifier{}
+	}
+	if cfg.QueryTimeout <= 0 {
+		cfg.QueryTimeout = 1 * time.Minute
+	}
+	if cfg.ResizeTimeout <= 0 {
+		cfg.ResizeTimeout = 20 * time.Minute
+	}
+	if cfg.SnapshotTimeout <= 0 {
+		cfg.SnapshotTimeout = 30 * time.Minute
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent()
+	}
+	if cfg.MaxResizeBackoff <= 0 {
+		cfg.MaxResizeBackoff = 2 * time.Hour
+	}
+	cfg.Backoff = cfg.Backoff.WithDefaults()
+	if cfg.Workers <= 0 {
+		cfg.Workers = min(len(cfg.Instances), maxDefaultWorkers)
+	}
+}
+
+// Run checks the instances, then runs the control loop until ctx is
+// canceled, which is a clean shutdown. It returns early on the pre-checks
+// failing, or an instance reaching a state the loop cannot handle, such as
+// the size limit.
+func Run(ctx context.Context, cfg Config) error {
+	if cfg.Settings == nil || len(cfg.Instances) == 0 {
+		return fmt.Errorf("%w: settings and instances are required", ErrConfig)
+	}
+	if err := cfg.Settings.validate(); err != nil {
+		return err
+	}
+	for id, o := range cfg.Settings.Overrides {
+		if err := o.validate(); err != nil {
+			return fmt.Errorf("instance %s: %w", id, err)
+		}
+	}
+	cfg.setDefaults()
+
+	// Check that instances exist, are compatible and that queries are working
+	var hb *heartbeat
+	if cfg.HeartbeatURL != "" {
+		hb = newHeartbeat(cfg.HeartbeatURL, cfg.QueryTimeout, cfg.UserAgent)
+	}
+	var om *otlpMetrics
+	if cfg.OTLPMetricsEndpoint != "" {
+		var err error
+		om, err = newOTLPMetrics(ctx, cfg.OTLPMetricsEndpoint, cfg.QueryTimeout)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrConfig, err)
+		}
+		defer om.Shutdown()
+	}
+	var sd *statsd
+	if cfg.StatsdAddr != "" {
+		var err error
+		sd, err = newStatsd(cfg.StatsdAddr, cfg.StatsdFormat)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrConfig, err)
+		}
+		defer sd.Close()
+	}
+	var hf *historyFile
+	var history []ResizeEvent
+	if cfg.HistoryFile != "" {
+		var err error
+		history, err = readHistoryFile(cfg.HistoryFile)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrConfig, err)
+		}
+		hf = &historyFile{path: cfg.HistoryFile}
+	}
+	controllers := make([]*Controller, 0, len(cfg.Instances))
+	for _, rdbAR := range cfg.Instances {
+		c, err := newInstanceController(ctx, rdbAR, cfg.Settings.ForInstance(rdbAR.instanceID), &cfg)
+		if err != nil {
+			slog.Error("error during instance pre-checks", slog.String("instance_id", rdbAR.instanceID), slog.String("region", rdbAR.Region()), slog.Any("error", err))
+			notifyShutdown(slog.Default(), cfg.Notifier, rdbAR.instanceID, err, cfg.QueryTimeout)
+			return err
+		}
+		c.heartbeat = hb
+		c.otlp = om
+		c.historyFile = hf
+		c.restoreHistory(history)
+		c.otlp.setVolumeSizeBytes(rdbAR.instanceID, rdbAR.Region(), float64(c.instance.Volume.Size))
+		controllers = append(controllers, c)
+	}
+	if cfg.NotifyStartupTest {
+		sendStartupTest(cfg.Notifier, cfg.QueryTimeout)
+	}
+	switch cfg.ResizePermission {
+	case PermissionGranted:
+		metricResizePermission.Set(1)
+	case PermissionMissing:
+		metricResizePermission.Set(0)
+		if cfg.AlertOnly {
+			slog.Info("the api credentials are not allowed to resize instances, as expected in alert-only mode")
+			break
+		}
+		slog.Error("the api credentials are not allowed to resize instances, resizes will fail until the RelationalDatabasesFullAccess permission set is granted")
+		for _, c := range controllers {
+			sendNotification(slog.Default(), cfg.Notifier, NewResizeEvent(
+				EventPermissionMissing,
+				c.rdbAR.InstanceID(),
+				"api credentials lack the permission to resize the instance",
+			), cfg.QueryTimeout)
+		}
+	}
+	for _, c := range controllers {
+		sendNotification(slog.Default(), cfg.Notifier, NewResizeEvent(
+			EventStartup,
+			c.rdbAR.InstanceID(),
+			fmt.Sprintf(
+				"rdb autoresizer %s started (trigger percentage: %g%%, volume size limits: %s)",
+				Version,
+				c.opts.TriggerPercent,
+				strings.Join(c.opts.DescribeSizeLimits(), ", "),
+			),
+		), cfg.QueryTimeout)
+	}
+
+	sc := sinceCollector{controllers: controllers}
+	if err := prometheus.Register(sc); err != nil {
+		slog.Warn("error registering metrics", slog.Any("error", err))
+	} else {
+		defer prometheus.Unregister(sc)
+	}
+
+	// Control Loop
+	pool := newWorkerPool(cfg.Workers)
+	defer pool.close()
+	check := func(controllers []*Controller) error {
+		err := pool.run(ctx, controllers)
+		if cfg.MetricsFile != "" {
+			writeMetricsFile(cfg.MetricsFile)
+		}
+		om.Flush()
+		sd.Send()
+		return err
+	}
+	iterate := func() error {
+		return check(dueControllers(controllers, time.Now()))
+	}
+	if cfg.Once {
+		err := iterate()
+		for _, c := range controllers {
+			c.pushgateway.Delete(slog.Default())
+		}
+		return err
+	}
+	if cfg.Started != nil {
+		if err := cfg.Started(controllers); err != nil {
+			return err
+		}
+	}
+	// Spread the first checks over the initial delay, the loop waking up
+	// for each of them
+	var starts []time.Time
+	if cfg.InitialDelay > 0 {
+		slog.Info("staggering the first checks over the initial delay", slog.Duration("initial_delay", cfg.InitialDelay))
+		starts = staggerFirstChecks(controllers, time.Now(), cfg.InitialDelay)
+	}
+	interval := shortestInterval(controllers)
+	slog.Debug(
+		"entering control loop",
+		slog.Duration("interval", interval),
+		slog.Int("instances", len(controllers)),
+		slog.Int("workers", cfg.Workers),
+	)
+	// The timer is rescheduled once an iteration completes, so that the
+	// interval is measured from the end of the work and late ticks never
+	// pile up.
+	runIteration := func() error {
+		if ctx.Err() != nil {
+			return nil
+		}
+		start := time.Now()
+		err := iterate()
+		if elapsed := time.Since(start); elapsed > interval {
+			slog.Warn(
+				"iteration took longer than the interval",
+				slog.Duration("elapsed", elapsed),
+				slog.Duration("interval", interval),
+			)
+		}
+		return err
+	}
+	// nextWait is the interval, or less until the next staggered first
+	// check.
+	nextWait := func() time.Duration {
+		now := time.Now()
+		for len(starts) > 0 && !now.Before(starts[0]) {
+			starts = starts[1:]
+		}
+		if len(starts) > 0 {
+			return min(interval, starts[0].Sub(now))
+		}
+		return interval
+	}
+	if len(starts) == 0 {
+		if err := runIteration(); err != nil {
+			return err
+		}
+	}
+	t := time.NewTimer(nextWait())
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("rdb autoresizer shutting down")
+			for _, rdbAR := range cfg.Instances {
+				notifyShutdown(slog.Default(), cfg.Notifier, rdbAR.instanceID, nil, cfg.QueryTimeout)
+			}
+			return nil
+		case <-t.C:
+			if err := runIteration(); err != nil {
+				return err
+			}
+			t.Reset(nextWait())
+		case <-cfg.Evaluate:
+			slog.Info("manually triggered evaluation")
+			if err := check(controllers); err != nil {
+				return err
+			}
+		case newOpts := <-cfg.Reloads:
+			changed := false
+			for _, c := range controllers {
+				instanceOpts := newOpts.ForInstance(c.rdbAR.InstanceID())
+				diff := DiffSettings(c.opts, instanceOpts)
+				if len(diff) == 0 {
+					continue
+				}
+				changed = true
+				slog.Info(
+					"configuration reloaded",
+					append([]any{slog.String("instance_id", c.rdbAR.InstanceID())}, diff...)...,
+				)
+				c.applySettings(ctx, instanceOpts)
+			}
+			if !changed {
+				slog.Info("configuration reloaded, nothing changed")
+			}
+			if newInterval := shortestInterval(controllers); newInterval != interval {
+				if !t.Stop() {
+					<-t.C
+				}
+				interval = newInterval
+				t.Reset(nextWait())
+			}
+		}
+	}
+}
+
+// logMaintenances logs the maintenance windows of the instance that are not
+// closed, as they may interfere with resizes.
+func logMaintenances(instance *rdb.Instance) {
+	for _, maintenance := range instance.Maintenances {
+		if maintenance.Status == rdb.MaintenanceStatusDone || maintenance.Status == rdb.MaintenanceStatusCanceled {
+			continue
+		}
+		attrs := []any{
+			slog.String("instance_id", instance.ID),
+			slog.String("status", maintenance.Status.String()),
+			slog.String("reason", maintenance.Reason),
+		}
+		if maintenance.StartsAt != nil {
+			attrs = append(attrs, slog.Time("starts_at", *maintenance.StartsAt))
+		}
+		if maintenance.StopsAt != nil {
+			attrs = append(attrs, slog.Time("stops_at", *maintenance.StopsAt))
+		}
+		slog.Info("instance maintenance scheduled", attrs...)
+	}
+}
+
+// maxVolumeSizeFor returns the hard cap of the volume size of the instance:
+// the maximum volume size of its node type, or the configured maximum volume
+// size if lower, 0 if neither is known. It fails with ErrConfig when the size
+// limit exceeds the node type maximum, as resizes would eventually be
+// rejected.
+func maxVolumeSizeFor(ctx context.Context, rdbAR instanceAPI, instance *rdb.Instance, opts *Settings, timeout time.Duration) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	logger := slog.With(
+		slog.String("instance_id", instance.ID),
+		slog.String("node_type", instance.NodeType),
+	)
+	maxSize, err := rdbAR.GetMaxVolumeSize(ctx, instance)
+	if err != nil {
+		logger.Warn("error getting the node type maximum volume size", slog.Any("error", err))
+		return opts.MaxVolumeSize, nil
+	}
+	logger.Info("node type maximum volume size", slog.String("max_size", HumanSize(maxSize)))
+	if len(opts.SizeLimits) > 0 {
+		if limit := opts.SizeLimits[len(opts.SizeLimits)-1]; uint64(limit) > maxSize {
+			return maxSize, fmt.Errorf(
+				"%w: volume size limit %s exceeds the node type %s maximum volume size %s",
+				ErrConfig, HumanSize(limit), instance.NodeType, HumanSize(maxSize),
+			)
+		}
+	}
+	if opts.MaxVolumeSize != 0 && opts.MaxVolumeSize < maxSize {
+		return opts.MaxVolumeSize, nil
+	}
+	return maxSize, nil
+}
+
+// minVolumeSizeFor returns the minimum size of the resize targets of the
+// instance: the largest of the configured minimum volume size and of the
+// node type minimum volume size. Errors fetching the latter are only logged.
+func minVolumeSizeFor(ctx context.Context, rdbAR instanceAPI, instance *rdb.Instance, opts *Settings, timeout time.Duration) uint64 {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	minSize, err := rdbAR.GetMinVolumeSize(ctx, instance)
+	if err != nil {
+		slog.Warn(
+			"error getting the node type minimum volume size",
+			slog.String("instance_id", instance.ID),
+			slog.String("node_type", instance.NodeType),
+			slog.Any("error", err),
+		)
+	}
+	return max(opts.MinVolumeSize, minSize)
+}
+
+// newInstanceController checks that the instance exists, is compatible and
+// that queries are working, then returns its controller. Transient errors
+// are retried.
+func newInstanceController(ctx context.Context, rdbAR *AutoResizer, opts *Settings, cfg *Config) (*Controller, error) {
+	var instance *rdb.Instance
+	// atLimit is set when the volume is already at the size limit, which
+	// only fails the pre-checks with ExitOnLimit.
+	var atLimit bool
+	err := retry(ctx, slog.Default(), cfg.Backoff, func() error {
+		ctx, cancel := context.WithTimeout(ctx, cfg.QueryTimeout)
+		defer cancel()
+		var err error
+		instance, err = rdbAR.GetInstance(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Info(
+			"rdb instance found",
+			slog.Group("instance",
+				slog.String("id", instance.ID),
+				slog.String("name", instance.Name),
+				slog.String("region", instance.Region.String()),
+				slog.String("engine", instance.Engine),
+				slog.Group("node", slog.String("type", instance.NodeType)),
+				slog.Group("volume",
+					slog.String("type", instance.Volume.Type.String()),
+					slog.String("size", HumanSize(instance.Volume.Size)),
+				),
+			),
+		)
+		logMaintenances(instance)
+		if err := checkProject(instance, rdbAR.projectID); err != nil {
+			return permanent(err)
+		}
+		if err := checkVolumeType(instance, opts); err != nil {
+			return permanent(err)
+		}
+		metricVolumeSizeBytes.WithLabelValues(instance.ID, rdbAR.Region()).Set(float64(instance.Volume.Size))
+		if err := opts.resolveSizeLimit(ctx, slog.Default(), rdbAR, instance); err != nil {
+			return err
+		}
+		if err := checkSizeLimit(instance, opts); err != nil {
+			if cfg.ExitOnLimit {
+				return permanent(err)
+			}
+			atLimit = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	maxVolumeSize, err := maxVolumeSizeFor(ctx, rdbAR, instance, opts, cfg.QueryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := newController(rdbAR, opts, cfg)
+	c.maxVolumeSize = maxVolumeSize
+	c.minVolumeSize = minVolumeSizeFor(ctx, rdbAR, instance, opts, cfg.QueryTimeout)
+	c.graceEnd = c.now().Add(cfg.StartupGrace)
+	c.nodeType = instance.NodeType
+	c.preResizeCmd = cfg.PreResizeCmd
+	c.postResizeCmd = cfg.PostResizeCmd
+	c.waitForResize = cfg.Once
+	if cfg.ResizeRate > 0 {
+		c.limiter = rate.NewLimiter(resizeLimit(cfg.ResizeRate, opts.Interval), resizeBurst(cfg.ResizeRate))
+	}
+	if cfg.PushgatewayAddr != "" {
+		c.pushgateway = newPushgateway(cfg.PushgatewayAddr, rdbAR.instanceID, cfg.QueryTimeout)
+	}
+	c.updateInstanceStatus(instance)
+	if atLimit {
+		c.setLimitReached(slog.With(slog.String("instance_id", instance.ID)), true, 0)
+	}
+	return c, nil
+}
@@ -0,0 +1,73 @@
+package autoresize
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+	}{
+		{
+			name: "no increment with a target free space",
+			settings: Settings{
+				TriggerPercent:  90,
+				SizeLimits:      []int64{100_000_000_000},
+				TargetFreeSpace: 20_000_000_000,
+				Interval:        time.Minute,
+			},
+		},
+		{
+			name: "no increment with a minimum free space",
+			settings: Settings{
+				TriggerPercent: 90,
+				SizeLimits:     []int64{100_000_000_000},
+				MinFreeSpace:   20_000_000_000,
+				Interval:       time.Minute,
+			},
+		},
+		{
+			name: "no interval",
+			settings: Settings{
+				TriggerPercent: 90,
+				SizeLimits:     []int64{100_000_000_000},
+				Increment:      10_000_000_000,
+			},
+		},
+		{
+			name: "override without increment",
+			settings: Settings{
+				TriggerPercent: 90,
+				SizeLimits:     []int64{100_000_000_000},
+				Increment:      10_000_000_000,
+				Interval:       time.Minute,
+				Overrides: map[string]*Settings{fakeInstanceID: {
+					TriggerPercent: 90,
+					SizeLimits:     []int64{100_000_000_000},
+					Interval:       time.Minute,
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ar := newFakeRDB(t)
+			f.setUsage(95)
+			err := Run(context.Background(), Config{
+				Instances: []*AutoResizer{ar},
+				Settings:  &tt.settings,
+				Once:      true,
+			})
+			if !errors.Is(err, ErrConfig) {
+				t.Fatalf("Run() error = %v, want %v", err, ErrConfig)
+			}
+			if upgrades := f.upgradeRequests(); len(upgrades) != 0 {
+				t.Fatalf("got %d upgrade requests, want none", len(upgrades))
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package autoresize
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+)
+
+// Stage is a resize step: above Threshold percent of usage, the volume is
+// grown by Increment bytes.
+type Stage struct {
+	Threshold float64
+	Increment uint64
+}
+
+// Trigger modes, combining the trigger percentage and free space.
+const (
+	// TriggerModeOr triggers a resize when either condition holds.
+	TriggerModeOr = "or"
+	// TriggerModeAnd triggers a resize when both conditions hold.
+	TriggerModeAnd = "and"
+)
+
+// Settings holds the validated options driving the control loop.
+type Settings struct {
+	TriggerPercent float64
+	// AlertPercent, when set below the trigger percentage, is the usage
+	// percentage above which a usage alert is sent, without resizing. See
+	// checkUsageAlert.
+	AlertPercent float64
+	// Stages, when set, replace the trigger percentage and increment. They
+	// are sorted by ascending threshold, the trigger percentage being the
+	// lowest threshold.
+	Stages []Stage
+	// SizeLimits is the ascending list of volume size limits. A single
+	// limit is handled as a list of one tier.
+	SizeLimits []int64
+	// LimitPercentOfMax, when set, derives the size limit from the node
+	// type maximum volume size. See resolveSizeLimit.
+	LimitPercentOfMax float64
+	// MaxVolumeSize, when set, is a hard cap of the volume size, on top of
+	// the node type maximum volume size. See maxVolumeSizeFor.
+	MaxVolumeSize uint64
+	// MinVolumeSize, when set, is the minimum size of resize targets, on
+	// top of the node type minimum volume size. See minVolumeSizeFor.
+	MinVolumeSize uint64
+	PredictHours  float64
+	// RequireUptime, when set, is the age below which instances are not
+	// resized, such as newly provisioned instances under load tests.
+	RequireUptime time.Duration
+	// IOPSTriggerPercent, when set, also triggers a resize on disk write
+	// iops saturation.
+	IOPSTriggerPercent float64
+	// Increment is the volume size increment, when there are no stages,
+	// and the unit the sizes computed from a free space are rounded up to.
+	// It is required.
+	Increment uint64
+	// Interval is the delay between checks, it is required.
+	Interval time.Duration
+	// TargetFreeSpace, when set, sizes resizes to leave this many free
+	// bytes instead of adding the increment. See targetSizeFor.
+	TargetFreeSpace uint64
+	// MinFreeSpace, when set, is the free space a resize always leaves,
+	// whatever the increment. See targetSizeFor.
+	MinFreeSpace uint64
+	// TriggerFreeSpace, when set, is the free space under which a resize
+	// is triggered, combined with the trigger percentage according to
+	// TriggerMode. See triggerReason.
+	TriggerFreeSpace uint64
+	TriggerMode      string
+	// MaxResizeDelta, when set, caps the size added by a single resize.
+	MaxResizeDelta uint64
+	// AdaptiveIncrement grows the increment for rapid successive resizes,
+	// up to IncrementCap. See adaptiveState.
+	AdaptiveIncrement bool
+	IncrementCap      uint64
+	AdaptiveReset     time.Duration
+	// CPUTriggerPercent, when set, triggers a node type upgrade to
+	// CPUUpgradeNodeType on sustained cpu usage. See checkCPU.
+	CPUTriggerPercent  float64
+	CPUUpgradeNodeType string
+	// EmergencyPercent, when set, is the usage percentage above which the
+	// volume is resized straight to the size limit. See emergencyReason.
+	EmergencyPercent float64
+	// LimitWarnPercent, when set, is the percentage of the size limit
+	// above which the volume size is reported as close to the limit.
+	LimitWarnPercent float64
+	// AllowLSSD also resizes local ssd volumes, which is experimental.
+	AllowLSSD bool
+	// Overrides are the settings of instances with overrides in the
+	// configuration file, keyed by instance id. See ForInstance.
+	Overrides map[string]*Settings
+}
+
+// Clone returns a copy of s, for an instance whose size limits are resolved
+// separately.
+func (s *Settings) Clone() *Settings {
+	c := *s
+	c.SizeLimits = slices.Clone(s.SizeLimits)
+	return &c
+}
+
+// validate checks that the settings required by the control loop are set.
+func (s *Settings) validate() error {
+	if s.Increment == 0 {
+		return fmt.Errorf("%w: the increment is required", ErrConfig)
+	}
+	if s.Interval <= 0 {
+		return fmt.Errorf("%w: the interval must be positive, got %s", ErrConfig, s.Interval)
+	}
+	return nil
+}
+
+// DescribeSizeLimits returns the volume size limits in a human readable form.
+func (s *Settings) DescribeSizeLimits() []string {
+	sizeLimits := make([]string, 0, len(s.SizeLimits))
+	for _, limit := range s.SizeLimits {
+		sizeLimits = append(sizeLimits, HumanSize(limit))
+	}
+	if s.LimitPercentOfMax != 0 {
+		sizeLimits = append(sizeLimits, fmt.Sprintf("%g%% of max", s.LimitPercentOfMax))
+	}
+	return sizeLimits
+}
+
+// ForInstance returns a copy of the settings of the instance, which are the
+// global settings unless overridden in the configuration file.
+func (s *Settings) ForInstance(id string) *Settings {
+	if o, ok := s.Overrides[id]; ok {
+		return o.Clone()
+	}
+	return s.Clone()
+}
+
+// resolveSizeLimit derives the size limit from the maximum volume size of the
+// instance node type, when configured as a percentage of it.
+func (s *Settings) resolveSizeLimit(ctx context.Context, logger *slog.Logger, rdbAR instanceAPI, instance *rdb.Instance) error {
+	if s.LimitPercentOfMax == 0 {
+		return nil
+	}
+	maxSize, err := rdbAR.GetMaxVolumeSize(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("error resolving node type maximum volume size: %w", err)
+	}
+	s.SizeLimits = []int64{int64(float64(maxSize) * s.LimitPercentOfMax / 100)}
+	logger.Info(
+		"volume size limit computed from node type",
+		slog.String("node_type", instance.NodeType),
+		slog.String("max_volume_size", HumanSize(maxSize)),
+		slog.Float64("limit_percent_of_max", s.LimitPercentOfMax),
+		slog.String("volume_size_limit", HumanSize(s.SizeLimits[0])),
+	)
+	return nil
+}
+
+// incrementFor returns the volume size increment to apply at the given
+// usage: the increment of the highest stage below usage, or the lowest stage
+// if none match.
+func (s *Settings) incrementFor(usage float64) uint64 {
+	if len(s.Stages) == 0 {
+		return s.Increment
+	}
+	increment := s.Stages[0].Increment
+	for _, st := range s.Stages {
+		if usage > st.Threshold {
+			increment = st.Increment
+		}
+	}
+	return increment
+}
+
+// targetSizeFor returns the size to resize a volume of currentSize to, at the
+// given usage. With a target or minimum free space, it is the size leaving
+// the larger of both free over usedBytes, rounded up to a multiple of the
+// increment and capped to the highest size limit. It is never less than the
+// current size plus the increment.
+func (s *Settings) targetSizeFor(currentSize uint64, usage float64, usedBytes uint64) uint64 {
+	minSize := currentSize + s.incrementFor(usage)
+	if s.TargetFreeSpace == 0 && s.MinFreeSpace == 0 {
+		return minSize
+	}
+	targetSize := usedBytes + max(s.TargetFreeSpace, s.MinFreeSpace)
+	if remainder := targetSize % s.Increment; remainder != 0 {
+		targetSize += s.Increment - remainder
+	}
+	if maxLimit := uint64(s.SizeLimits[len(s.SizeLimits)-1]); targetSize > maxLimit {
+		targetSize = maxLimit
+	}
+	return max(targetSize, minSize)
+}
+
+// sizeLimitFor returns the smallest size limit that is greater than or
+// equal to size, and false when every limit is below size.
+func (s *Settings) sizeLimitFor(size int64) (int64, bool) {
+	for _, limit := range s.SizeLimits {
+		if limit >= size {
+			return limit, true
+		}
+	}
+	return 0, false
+}
+
+// DiffSettings returns a log attribute for each setting changed between
+// old and new.
+func DiffSettings(old, new *Settings) []any {
+	var diff []any
+	add := func(name string, oldValue, newValue any) {
+		if oldStr, newStr := fmt.Sprint(oldValue), fmt.Sprint(newValue); oldStr != newStr {
+			diff = append(diff, slog.String(name, oldStr+" -> "+newStr))
+		}
+	}
+	humanSizes := func(sizes []int64) []string {
+		result := make([]string, 0, len(sizes))
+		for _, size := range sizes {
+			result = append(result, HumanSize(size))
+		}
+		return result
+	}
+	add("trigger_percentage", old.TriggerPercent, new.TriggerPercent)
+	add("alert_threshold_percentage", old.AlertPercent, new.AlertPercent)
+	add("volume_size_limits", humanSizes(old.SizeLimits), humanSizes(new.SizeLimits))
+	add("limit_percent_of_max", old.LimitPercentOfMax, new.LimitPercentOfMax)
+	add("max_volume_size", HumanSize(old.MaxVolumeSize), HumanSize(new.MaxVolumeSize))
+	add("min_volume_size", HumanSize(old.MinVolumeSize), HumanSize(new.MinVolumeSize))
+	add("increment", HumanSize(old.Increment), HumanSize(new.Increment))
+	if !slices.Equal(old.Stages, new.Stages) {
+		add("stages", old.Stages, new.Stages)
+	}
+	add("interval", old.Interval, new.Interval)
+	add("predict_hours", old.PredictHours, new.PredictHours)
+	add("require_uptime", old.RequireUptime, new.RequireUptime)
+	add("iops_trigger_percentage", old.IOPSTriggerPercent, new.IOPSTriggerPercent)
+	add("increment_cap", HumanSize(old.IncrementCap), HumanSize(new.IncrementCap))
+	add("cpu_trigger_percentage", old.CPUTriggerPercent, new.CPUTriggerPercent)
+	add("cpu_upgrade_node_type", old.CPUUpgradeNodeType, new.CPUUpgradeNodeType)
+	add("target_free_space", HumanSize(old.TargetFreeSpace), HumanSize(new.TargetFreeSpace))
+	add("min_free_space", HumanSize(old.MinFreeSpace), HumanSize(new.MinFreeSpace))
+	add("trigger_free_space", HumanSize(old.TriggerFreeSpace), HumanSize(new.TriggerFreeSpace))
+	add("trigger_mode", old.TriggerMode, new.TriggerMode)
+	add("max_resize_delta", HumanSize(old.MaxResizeDelta), HumanSize(new.MaxResizeDelta))
+	add("emergency_threshold", old.EmergencyPercent, new.EmergencyPercent)
+	add("volume_size_limit_warning_percentage", old.LimitWarnPercent, new.LimitWarnPercent)
+	return diff
+}
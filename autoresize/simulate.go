@@ -0,0 +1,219 @@
+package autoresize
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+const simulatedInstanceID = "simulated-instance"
+
+// loadUsageSamples reads a csv file of timestamp,usage_percent lines.
+// Timestamps are in RFC3339 format. Empty lines and lines starting
+// with # are ignored.
+func loadUsageSamples(path string) ([]usageSample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	var samples []usageSample
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		line, _ := r.FieldPos(0)
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid timestamp: %w", path, line, err)
+		}
+		usage, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid usage percentage: %w", path, line, err)
+		}
+		if len(samples) > 0 && !t.After(samples[len(samples)-1].time) {
+			return nil, fmt.Errorf("%s:%d: timestamps must be increasing", path, line)
+		}
+		samples = append(samples, usageSample{time: t, value: usage})
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("%s: no usage sample", path)
+	}
+	return samples, nil
+}
+
+// simulatedInstance replaces the rdb api with a fake instance, whose
+// disk usage is replayed from samples. Usage samples are relative to the
+// initial volume size, so that resizes lower the reported usage like
+// they would on a real instance.
+type simulatedInstance struct {
+	logger      *slog.Logger
+	initialSize uint64
+	volumeSize  uint64
+	usage       float64
+}
+
+func newSimulatedInstance(logger *slog.Logger, volumeSize uint64) *simulatedInstance {
+	return &simulatedInstance{
+		logger:      logger,
+		initialSize: volumeSize,
+		volumeSize:  volumeSize,
+	}
+}
+
+func (s *simulatedInstance) InstanceID() string {
+	return simulatedInstanceID
+}
+
+func (s *simulatedInstance) Region() string {
+	return scw.RegionFrPar.String()
+}
+
+func (s *simulatedInstance) GetInstance(ctx context.Context) (*rdb.Instance, error) {
+	return &rdb.Instance{
+		ID:       simulatedInstanceID,
+		Name:     simulatedInstanceID,
+		Region:   scw.RegionFrPar,
+		Status:   rdb.InstanceStatusReady,
+		Engine:   "simulated",
+		NodeType: "simulated",
+		Volume: &rdb.Volume{
+			Type: rdb.VolumeTypeBssd,
+			Size: scw.Size(s.volumeSize),
+		},
+	}, nil
+}
+
+func (s *simulatedInstance) RawInstance(ctx context.Context) (json.RawMessage, error) {
+	instance, _ := s.GetInstance(ctx)
+	return json.Marshal(instance)
+}
+
+func (s *simulatedInstance) RawMetrics(ctx context.Context, metricName string) (json.RawMessage, error) {
+	return nil, errors.New("no raw metrics in simulation")
+}
+
+func (s *simulatedInstance) WaitForInstance(ctx context.Context, timeout time.Duration) (*rdb.Instance, error) {
+	return s.GetInstance(ctx)
+}
+
+func (s *simulatedInstance) GetMaxVolumeSize(ctx context.Context, instance *rdb.Instance) (uint64, error) {
+	return 0, errors.New("maximum volume size is not available in simulation")
+}
+
+func (s *simulatedInstance) GetMinVolumeSize(ctx context.Context, instance *rdb.Instance) (uint64, error) {
+	return 0, nil
+}
+
+func (s *simulatedInstance) ResizeVolume(ctx context.Context, newSize uint64) (*rdb.Instance, error) {
+	s.logger.Info(
+		"simulated resize",
+		slog.String("old_size", HumanSize(s.volumeSize)),
+		slog.String("new_size", HumanSize(newSize)),
+	)
+	s.volumeSize = newSize
+	return s.GetInstance(ctx)
+}
+
+func (s *simulatedInstance) ResizeVolumeWait(ctx context.Context, newSize uint64, pollInterval time.Duration) (*rdb.Instance, error) {
+	return s.ResizeVolume(ctx, newSize)
+}
+
+func (s *simulatedInstance) CreateSnapshotWait(ctx context.Context, name string, pollInterval time.Duration) (*rdb.Snapshot, error) {
+	s.logger.Info("simulated snapshot", slog.String("name", name))
+	return &rdb.Snapshot{ID: "simulated", Name: name, Status: rdb.SnapshotStatusReady}, nil
+}
+
+func (s *simulatedInstance) BackupInProgress(ctx context.Context, instance *rdb.Instance) (bool, error) {
+	return false, nil
+}
+
+func (s *simulatedInstance) UpgradeNodeType(ctx context.Context, nodeType string) (*rdb.Instance, error) {
+	return nil, errors.New("node type upgrades are not available in simulation")
+}
+
+func (s *simulatedInstance) GetMetric(ctx context.Context, metricName string) (float64, error) {
+	return 0, ErrNoMetricData
+}
+
+func (s *simulatedInstance) usedBytes() float64 {
+	return s.usage / 100 * float64(s.initialSize)
+}
+
+func (s *simulatedInstance) GetDiskUsagePercent(ctx context.Context) (float64, time.Time, error) {
+	return s.usedBytes() / float64(s.volumeSize) * 100, time.Time{}, nil
+}
+
+func (s *simulatedInstance) GetDiskIOPSPercent(ctx context.Context) (float64, error) {
+	return 0, nil
+}
+
+func (s *simulatedInstance) GetDiskUsageBytes(ctx context.Context) (uint64, uint64, error) {
+	return uint64(s.usedBytes()), s.volumeSize, nil
+}
+
+// Simulate replays the usage samples of path through the controller, without
+// calling the scaleway api. No hook is run and no notification is sent.
+func Simulate(path string, volumeSize uint64, opts *Settings) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	samples, err := loadUsageSamples(path)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	sim := newSimulatedInstance(slog.Default(), volumeSize)
+	instance, _ := sim.GetInstance(ctx)
+	if err := opts.resolveSizeLimit(ctx, slog.Default(), sim, instance); err != nil {
+		return err
+	}
+	if err := checkSizeLimit(instance, opts); err != nil {
+		return err
+	}
+
+	cfg := &Config{ExitOnLimit: true}
+	cfg.setDefaults()
+	c := newController(sim, opts, cfg)
+	c.nodeType = instance.NodeType
+	c.maxVolumeSize = opts.MaxVolumeSize
+	c.minVolumeSize = opts.MinVolumeSize
+	c.updateInstanceStatus(instance)
+	for _, sample := range samples {
+		sample := sample
+		sim.usage = sample.value
+		c.now = func() time.Time { return sample.time }
+		if err := c.iterate(ctx); err != nil {
+			return err
+		}
+	}
+	status := c.Status()
+	slog.Info(
+		"simulation finished",
+		slog.Int("samples", len(samples)),
+		slog.Int("resize_count", status.ResizeCount),
+		slog.String("initial_volume_size", HumanSize(volumeSize)),
+		slog.String("final_volume_size", HumanSize(sim.volumeSize)),
+	)
+	return nil
+}
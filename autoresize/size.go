@@ -0,0 +1,31 @@
+package autoresize
+
+import (
+	"github.com/docker/go-units"
+)
+
+// Units used to parse and display sizes.
+const (
+	UnitsDecimal = "decimal"
+	UnitsBinary  = "binary"
+)
+
+// Units holds the units used by ParseSize and HumanSize.
+var Units = UnitsDecimal
+
+// ParseSize parses a human-readable size, such as 10GB, in the configured
+// units.
+func ParseSize(size string) (int64, error) {
+	if Units == UnitsBinary {
+		return units.RAMInBytes(size)
+	}
+	return units.FromHumanSize(size)
+}
+
+// HumanSize formats a size in bytes in the configured units.
+func HumanSize[T ~int64 | ~uint64](size T) string {
+	if Units == UnitsBinary {
+		return units.BytesSize(float64(size))
+	}
+	return units.HumanSize(float64(size))
+}
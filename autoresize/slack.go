@@ -0,0 +1,151 @@
+package autoresize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+const (
+	slackColorSuccess = "good"
+	slackColorFailure = "danger"
+	slackColorWarning = "warning"
+)
+
+// SlackNotifier posts events to a Slack incoming webhook.
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+
+	mu sync.Mutex
+	// lastEvent identifies the last resize event sent, so that a given
+	// resize is only ever notified once.
+	lastEvent string
+}
+
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{
+		url:    url,
+		client: &http.Client{},
+	}
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachment struct {
+	Color     string       `json:"color,omitempty"`
+	Title     string       `json:"title"`
+	TitleLink string       `json:"title_link,omitempty"`
+	Text      string       `json:"text,omitempty"`
+	Fields    []slackField `json:"fields,omitempty"`
+}
+
+type slackMessage struct {
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// consoleURL returns the Scaleway console url of the event instance.
+func consoleURL(event ResizeEvent) string {
+	if event.InstanceID == "" || event.Region == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://console.scaleway.com/rdb/instances/%s/%s/overview", event.Region, event.InstanceID)
+}
+
+func slackMessageFor(event ResizeEvent) slackMessage {
+	attachment := slackAttachment{
+		Title:     event.Message,
+		TitleLink: consoleURL(event),
+		Text:      event.Error,
+	}
+	switch {
+	case event.EventType == EventResize, event.EventType == EventNodeUpgrade && event.Error == "":
+		attachment.Color = slackColorSuccess
+	case event.Error != "", event.EventType == EventEmergency, event.EventType == EventLimitReached, event.EventType == EventPermissionMissing:
+		attachment.Color = slackColorFailure
+	case event.EventType == EventUsageAlert:
+		attachment.Color = slackColorWarning
+	}
+	instance := event.InstanceName
+	if instance == "" {
+		instance = event.InstanceID
+	}
+	if instance != "" {
+		attachment.Fields = append(attachment.Fields, slackField{Title: "Instance", Value: instance, Short: true})
+	}
+	if event.Region != "" {
+		attachment.Fields = append(attachment.Fields, slackField{Title: "Region", Value: event.Region, Short: true})
+	}
+	if event.NodeType != "" {
+		attachment.Fields = append(attachment.Fields, slackField{Title: "Node type", Value: event.NodeType, Short: true})
+	}
+	if event.OldSize != 0 {
+		attachment.Fields = append(attachment.Fields, slackField{Title: "Old size", Value: HumanSize(event.OldSize), Short: true})
+	}
+	if event.NewSize != 0 {
+		attachment.Fields = append(attachment.Fields, slackField{Title: "New size", Value: HumanSize(event.NewSize), Short: true})
+	}
+	if event.UsagePercent != 0 {
+		attachment.Fields = append(attachment.Fields, slackField{Title: "Disk usage", Value: fmt.Sprintf("%.1f%%", event.UsagePercent), Short: true})
+	}
+	return slackMessage{Attachments: []slackAttachment{attachment}}
+}
+
+func slackAlertMessageFor(event AlertEvent) slackMessage {
+	return slackMessage{Attachments: []slackAttachment{{
+		Color: slackColorFailure,
+		Title: event.Message,
+		Text:  event.LastError,
+		Fields: []slackField{
+			{Title: "Instance", Value: event.InstanceID, Short: true},
+			{Title: "Failures", Value: fmt.Sprint(event.FailureCount), Short: true},
+		},
+	}}}
+}
+
+func (sn *SlackNotifier) Notify(ctx context.Context, event Event) error {
+	var message slackMessage
+	switch event := event.(type) {
+	case ResizeEvent:
+		if event.EventType == EventResize || event.EventType == EventResizeFailed {
+			key := fmt.Sprintf("%s/%s/%d/%d", event.EventType, event.InstanceID, event.OldSize, event.NewSize)
+			sn.mu.Lock()
+			duplicate := key == sn.lastEvent
+			sn.lastEvent = key
+			sn.mu.Unlock()
+			if duplicate {
+				return nil
+			}
+		}
+		message = slackMessageFor(event)
+	case AlertEvent:
+		message = slackAlertMessageFor(event)
+	default:
+		return fmt.Errorf("unsupported event type: %s", event.Type())
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sn.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := sn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack returned unexpected status: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package autoresize
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// SNSNotifier publishes events as JSON to an AWS SNS topic. The instance id
+// and event type are set as message attributes, for subscription filters.
+type SNSNotifier struct {
+	topicARN string
+	client   *sns.Client
+}
+
+// NewSNSNotifier creates an SNS notifier, configured from the standard AWS
+// credentials chain. The region defaults to the region of the topic.
+func NewSNSNotifier(ctx context.Context, topicARN string) (*SNSNotifier, error) {
+	topic, err := arn.Parse(topicARN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sns topic arn: %w", err)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading aws configuration: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = topic.Region
+	}
+	return &SNSNotifier{
+		topicARN: topicARN,
+		client:   sns.NewFromConfig(cfg),
+	}, nil
+}
+
+func (sn *SNSNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var instanceID string
+	switch event := event.(type) {
+	case ResizeEvent:
+		instanceID = event.InstanceID
+	case AlertEvent:
+		instanceID = event.InstanceID
+	}
+	attributes := map[string]types.MessageAttributeValue{
+		"event_type": {DataType: aws.String("String"), StringValue: aws.String(event.Type())},
+	}
+	if instanceID != "" {
+		attributes["instance_id"] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(instanceID)}
+	}
+	_, err = sn.client.Publish(ctx, &sns.PublishInput{
+		TopicArn:          aws.String(sn.topicARN),
+		Message:           aws.String(string(body)),
+		MessageAttributes: attributes,
+	})
+	return err
+}
@@ -0,0 +1,112 @@
+package autoresize
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Statsd line formats.
+const (
+	// StatsdFormatStatsd is the plain statsd format, which has no tags: the
+	// instance id and the other labels are appended to the metric name.
+	StatsdFormatStatsd = "statsd"
+	// StatsdFormatDogStatsd is the DogStatsD format, the instance id, region
+	// and other labels being sent as tags.
+	StatsdFormatDogStatsd = "dogstatsd"
+)
+
+// statsdPrefix selects the metrics sent over statsd, the go runtime and
+// process ones are left to the prometheus endpoint.
+const statsdPrefix = "rdb_autoresize_"
+
+// statsd sends the metrics of the instances as gauges to a statsd server
+// over udp after each iteration. Counters are sent as gauges of their total,
+// as statsd counters expect increments.
+type statsd struct {
+	conn   net.Conn
+	format string
+}
+
+func newStatsd(addr, format string) (*statsd, error) {
+	switch format {
+	case "", StatsdFormatStatsd:
+		format = StatsdFormatStatsd
+	case StatsdFormatDogStatsd:
+	default:
+		return nil, fmt.Errorf("invalid statsd format '%s', must be statsd or dogstatsd", format)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to statsd: %w", err)
+	}
+	return &statsd{conn: conn, format: format}, nil
+}
+
+// Send sends the current value of the metrics, one packet per metric.
+// Errors are only logged.
+func (s *statsd) Send() {
+	if s == nil {
+		return
+	}
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		slog.Warn("error gathering metrics for statsd", slog.Any("error", err))
+		return
+	}
+	var failed error
+	for _, mf := range mfs {
+		if !strings.HasPrefix(mf.GetName(), statsdPrefix) {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			var value float64
+			switch {
+			case m.GetGauge() != nil:
+				value = m.GetGauge().GetValue()
+			case m.GetCounter() != nil:
+				value = m.GetCounter().GetValue()
+			default:
+				continue
+			}
+			if _, err := s.conn.Write([]byte(s.line(mf.GetName(), value, m.GetLabel()))); err != nil {
+				failed = err
+			}
+		}
+	}
+	if failed != nil {
+		slog.Warn("error sending metrics to statsd", slog.Any("error", failed))
+	}
+}
+
+// line formats a gauge line, such as, in the dogstatsd format:
+// rdb_autoresize_disk_usage_percent:42.5|g|#instance_id:<id>,region:fr-par
+func (s *statsd) line(name string, value float64, labels []*dto.LabelPair) string {
+	var tags []string
+	for _, l := range labels {
+		switch s.format {
+		case StatsdFormatDogStatsd:
+			tags = append(tags, l.GetName()+":"+l.GetValue())
+		default:
+			name += "." + l.GetValue()
+		}
+	}
+	line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|g"
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+// Close closes the connection.
+func (s *statsd) Close() {
+	if s == nil {
+		return
+	}
+	s.conn.Close()
+}
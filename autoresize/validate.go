@@ -0,0 +1,56 @@
+package autoresize
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Validate runs the startup checks and a metric read without starting the
+// control loop or changing anything, logging each finding. It returns true
+// if every check passed.
+func Validate(ctx context.Context, rdbAR *AutoResizer, opts *Settings) bool {
+	success := true
+	report := func(check string, err error, attrs ...any) {
+		attrs = append([]any{slog.String("check", check)}, attrs...)
+		if err != nil {
+			success = false
+			slog.Error("validation check failed", append(attrs, slog.Any("error", err))...)
+			return
+		}
+		slog.Info("validation check passed", attrs...)
+	}
+
+	instance, err := rdbAR.GetInstance(ctx)
+	if err != nil {
+		report("instance", err)
+		return false
+	}
+	report("instance", nil,
+		slog.String("name", instance.Name),
+		slog.String("status", instance.Status.String()),
+	)
+	report("project", checkProject(instance, rdbAR.projectID), slog.String("project_id", instance.ProjectID))
+	report("volume_type", checkVolumeType(instance, opts), slog.String("volume_type", instance.Volume.Type.String()))
+	if err := opts.resolveSizeLimit(ctx, slog.Default(), rdbAR, instance); err != nil {
+		report("size_limit", err)
+	} else {
+		report("size_limit", checkSizeLimit(instance, opts), slog.String("size", HumanSize(instance.Volume.Size)))
+		// ctx bounds the query already
+		timeout := time.Minute
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline)
+		}
+		maxSize, err := maxVolumeSizeFor(ctx, rdbAR, instance, opts, timeout)
+		report("node_max_volume_size", err, slog.String("max_size", HumanSize(maxSize)))
+	}
+	usage, _, err := rdbAR.GetDiskUsagePercent(ctx)
+	report("disk_usage", err, slog.Float64("percent_used", usage))
+
+	if success {
+		slog.Info("configuration is valid")
+	} else {
+		slog.Error("configuration is invalid")
+	}
+	return success
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configFile is the format of the configuration file, holding settings that
+// cannot be expressed with flags, and overrides of flags that can be changed
+// by reloading the file.
+type configFile struct {
+	// TriggerPercentage overrides -trigger-percentage.
+	TriggerPercentage float64 `yaml:"trigger_percentage"`
+	// VolumeSizeLimit overrides -volume-size-limit.
+	VolumeSizeLimit string `yaml:"volume_size_limit"`
+	// Increment is the volume size increment, defaults to 5GB.
+	Increment string `yaml:"increment"`
+	// Interval is the delay between checks, defaults to 5m.
+	Interval string `yaml:"interval"`
+	// Stages are resize stages, see Settings.Stages.
+	Stages []struct {
+		Threshold float64 `yaml:"threshold"`
+		Increment string  `yaml:"increment"`
+	} `yaml:"stages"`
+	// Instances are per-instance overrides, keyed by instance id.
+	Instances map[string]instanceConfig `yaml:"instances"`
+}
+
+// instanceConfig overrides the global settings for a single instance. Unset
+// fields fall back to the global settings.
+type instanceConfig struct {
+	TriggerPercentage float64 `yaml:"trigger_percentage"`
+	VolumeSizeLimit   string  `yaml:"volume_size_limit"`
+	Increment         string  `yaml:"increment"`
+	Interval          string  `yaml:"interval"`
+}
+
+func loadConfigFile(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config configFile
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return &config, nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+	iam "github.com/scaleway/scaleway-sdk-go/api/iam/v1alpha1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// apiCredentials returns the api access and secret keys, from the
+// SCW_ACCESS_KEY and SCW_SECRET_KEY environment variables, or else from the
+// scaleway config profile, which may be nil. The error names the keys that
+// are set by neither.
+func apiCredentials(profile *scw.Profile) (accessKey, secretKey string, err error) {
+	accessKey, secretKey = os.Getenv("SCW_ACCESS_KEY"), os.Getenv("SCW_SECRET_KEY")
+	if profile != nil {
+		if accessKey == "" && profile.AccessKey != nil {
+			accessKey = *profile.AccessKey
+		}
+		if secretKey == "" && profile.SecretKey != nil {
+			secretKey = *profile.SecretKey
+		}
+	}
+	var missing []string
+	if accessKey == "" {
+		missing = append(missing, "SCW_ACCESS_KEY")
+	}
+	if secretKey == "" {
+		missing = append(missing, "SCW_SECRET_KEY")
+	}
+	if len(missing) > 0 {
+		return "", "", fmt.Errorf("%w: missing api credentials, set %s or a scaleway config profile", autoresize.ErrConfig, strings.Join(missing, " and "))
+	}
+	return accessKey, secretKey, nil
+}
+
+// checkCredentials verifies the client credentials, logs the project and
+// organization they belong to, and returns whether they are allowed to
+// resize instances. Credentials without the permission to look themselves
+// up are not considered invalid, their resize permission being unknown.
+func checkCredentials(ctx context.Context, client *scw.Client) (autoresize.Permission, error) {
+	accessKey, _ := client.GetAccessKey()
+	iamApi := iam.NewAPI(client)
+	apiKey, err := iamApi.GetAPIKey(&iam.GetAPIKeyRequest{
+		AccessKey: accessKey,
+	}, scw.WithContext(ctx))
+	if autoresize.IsAuthError(err) {
+		return autoresize.PermissionUnknown, fmt.Errorf("invalid api credentials: %w", err)
+	}
+	if err != nil {
+		slog.Warn("unable to verify api credentials", slog.Any("error", err))
+		return autoresize.PermissionUnknown, nil
+	}
+
+	var organizationID string
+	var owner bool
+	switch {
+	case apiKey.ApplicationID != nil:
+		application, err := iamApi.GetApplication(&iam.GetApplicationRequest{
+			ApplicationID: *apiKey.ApplicationID,
+		}, scw.WithContext(ctx))
+		if err == nil {
+			organizationID = application.OrganizationID
+		}
+	case apiKey.UserID != nil:
+		user, err := iamApi.GetUser(&iam.GetUserRequest{
+			UserID: *apiKey.UserID,
+		}, scw.WithContext(ctx))
+		if err == nil {
+			organizationID = user.OrganizationID
+			owner = user.Type == iam.UserTypeOwner
+		}
+	}
+	projectID, _ := client.GetDefaultProjectID()
+	slog.Info(
+		"api credentials verified",
+		slog.String("access_key", apiKey.AccessKey),
+		slog.String("key_default_project_id", apiKey.DefaultProjectID),
+		slog.String("organization_id", organizationID),
+		slog.String("project_id", projectID),
+	)
+	if owner {
+		return autoresize.PermissionGranted, nil
+	}
+	permission, err := resizePermission(ctx, iamApi, apiKey, projectID)
+	if err != nil {
+		slog.Warn("unable to verify the resize permission of the api credentials", slog.Any("error", err))
+	}
+	return permission, nil
+}
+
+// resizePermissionSets are the permission sets allowing to upgrade instances.
+var resizePermissionSets = []string{"RelationalDatabasesFullAccess", "AllProductsFullAccess"}
+
+// rdbPermissionSetPrefixes are the prefixes of the names of the permission
+// sets which may allow to upgrade instances, the other ones applying to other
+// products.
+var rdbPermissionSetPrefixes = []string{"RelationalDatabases", "AllProducts"}
+
+// permissionSetResize returns whether the permission set allows to upgrade
+// instances: granted for the resizePermissionSets, missing for read-only
+// sets and sets of other products, and unknown for the other sets, such as
+// narrower rdb sets.
+func permissionSetResize(name string) autoresize.Permission {
+	switch {
+	case slices.Contains(resizePermissionSets, name):
+		return autoresize.PermissionGranted
+	case strings.HasSuffix(name, "ReadOnly"):
+		return autoresize.PermissionMissing
+	case slices.ContainsFunc(rdbPermissionSetPrefixes, func(prefix string) bool { return strings.HasPrefix(name, prefix) }):
+		return autoresize.PermissionUnknown
+	}
+	return autoresize.PermissionMissing
+}
+
+// rulesResizePermission returns whether the policy rules allow to upgrade
+// instances of the project, if set. The permission is only missing when no
+// rule may allow it, an error listing the permission sets that may.
+func rulesResizePermission(rules []*iam.Rule, projectID string) (autoresize.Permission, error) {
+	var unknown []string
+	for _, rule := range rules {
+		if rule.PermissionSetNames == nil {
+			continue
+		}
+		if projectID != "" && rule.ProjectIDs != nil && !slices.Contains(*rule.ProjectIDs, projectID) {
+			continue
+		}
+		for _, name := range *rule.PermissionSetNames {
+			switch permissionSetResize(name) {
+			case autoresize.PermissionGranted:
+				return autoresize.PermissionGranted, nil
+			case autoresize.PermissionUnknown:
+				if !slices.Contains(unknown, name) {
+					unknown = append(unknown, name)
+				}
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		return autoresize.PermissionUnknown, fmt.Errorf("permission sets %s may allow resizes, they are not recognized", strings.Join(unknown, ", "))
+	}
+	return autoresize.PermissionMissing, nil
+}
+
+// resizePermission looks up the policy rules of the api key bearer, directly
+// or through its groups, to tell whether they allow to upgrade instances of
+// the project, if set. See rulesResizePermission.
+func resizePermission(ctx context.Context, iamApi *iam.API, apiKey *iam.APIKey, projectID string) (autoresize.Permission, error) {
+	policies := &iam.ListPoliciesRequest{}
+	groups := &iam.ListGroupsRequest{}
+	switch {
+	case apiKey.ApplicationID != nil:
+		policies.ApplicationIDs = []string{*apiKey.ApplicationID}
+		groups.ApplicationIDs = []string{*apiKey.ApplicationID}
+	case apiKey.UserID != nil:
+		policies.UserIDs = []string{*apiKey.UserID}
+		groups.UserIDs = []string{*apiKey.UserID}
+	default:
+		return autoresize.PermissionUnknown, fmt.Errorf("api key has no bearer")
+	}
+	groupsResp, err := iamApi.ListGroups(groups, scw.WithAllPages(), scw.WithContext(ctx))
+	if err != nil {
+		return autoresize.PermissionUnknown, err
+	}
+	requests := []*iam.ListPoliciesRequest{policies}
+	if len(groupsResp.Groups) > 0 {
+		groupPolicies := &iam.ListPoliciesRequest{}
+		for _, group := range groupsResp.Groups {
+			groupPolicies.GroupIDs = append(groupPolicies.GroupIDs, group.ID)
+		}
+		requests = append(requests, groupPolicies)
+	}
+	var policyList []*iam.Policy
+	for _, req := range requests {
+		resp, err := iamApi.ListPolicies(req, scw.WithAllPages(), scw.WithContext(ctx))
+		if err != nil {
+			return autoresize.PermissionUnknown, err
+		}
+		policyList = append(policyList, resp.Policies...)
+	}
+	var rules []*iam.Rule
+	for _, policy := range policyList {
+		resp, err := iamApi.ListRules(&iam.ListRulesRequest{
+			PolicyID: &policy.ID,
+		}, scw.WithAllPages(), scw.WithContext(ctx))
+		if err != nil {
+			return autoresize.PermissionUnknown, err
+		}
+		rules = append(rules, resp.Rules...)
+	}
+	return rulesResizePermission(rules, projectID)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+	iam "github.com/scaleway/scaleway-sdk-go/api/iam/v1alpha1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+func TestAPICredentials(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		profile       *scw.Profile
+		wantAccessKey string
+		wantSecretKey string
+		wantErr       string
+	}{
+		{
+			name:          "environment",
+			env:           map[string]string{"SCW_ACCESS_KEY": "SCWENV", "SCW_SECRET_KEY": "env-secret"},
+			wantAccessKey: "SCWENV",
+			wantSecretKey: "env-secret",
+		},
+		{
+			name:          "profile",
+			profile:       &scw.Profile{AccessKey: scw.StringPtr("SCWPROFILE"), SecretKey: scw.StringPtr("profile-secret")},
+			wantAccessKey: "SCWPROFILE",
+			wantSecretKey: "profile-secret",
+		},
+		{
+			name:          "environment over profile",
+			env:           map[string]string{"SCW_ACCESS_KEY": "SCWENV"},
+			profile:       &scw.Profile{AccessKey: scw.StringPtr("SCWPROFILE"), SecretKey: scw.StringPtr("profile-secret")},
+			wantAccessKey: "SCWENV",
+			wantSecretKey: "profile-secret",
+		},
+		{
+			name:    "no environment nor profile",
+			wantErr: "invalid configuration: missing api credentials, set SCW_ACCESS_KEY and SCW_SECRET_KEY or a scaleway config profile",
+		},
+		{
+			name:    "profile without secret key",
+			profile: &scw.Profile{AccessKey: scw.StringPtr("SCWPROFILE")},
+			wantErr: "invalid configuration: missing api credentials, set SCW_SECRET_KEY or a scaleway config profile",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"SCW_ACCESS_KEY", "SCW_SECRET_KEY"} {
+				t.Setenv(name, tt.env[name])
+			}
+			accessKey, secretKey, err := apiCredentials(tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("apiCredentials() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apiCredentials() error = %v", err)
+			}
+			if accessKey != tt.wantAccessKey || secretKey != tt.wantSecretKey {
+				t.Fatalf("apiCredentials() = %q, %q, want %q, %q", accessKey, secretKey, tt.wantAccessKey, tt.wantSecretKey)
+			}
+		})
+	}
+}
+
+func TestRulesResizePermission(t *testing.T) {
+	const projectID = "22222222-2222-2222-2222-222222222222"
+	rule := func(projectIDs []string, names ...string) *iam.Rule {
+		r := &iam.Rule{PermissionSetNames: &names}
+		if projectIDs != nil {
+			r.ProjectIDs = &projectIDs
+		}
+		return r
+	}
+	tests := []struct {
+		name    string
+		rules   []*iam.Rule
+		want    autoresize.Permission
+		wantErr bool
+	}{
+		{
+			name:  "full access",
+			rules: []*iam.Rule{rule(nil, "RelationalDatabasesFullAccess")},
+			want:  autoresize.PermissionGranted,
+		},
+		{
+			name:  "all products in the project",
+			rules: []*iam.Rule{rule([]string{projectID}, "AllProductsFullAccess")},
+			want:  autoresize.PermissionGranted,
+		},
+		{
+			name:  "full access in another project",
+			rules: []*iam.Rule{rule([]string{"33333333-3333-3333-3333-333333333333"}, "RelationalDatabasesFullAccess")},
+			want:  autoresize.PermissionMissing,
+		},
+		{
+			name:  "read only and other products",
+			rules: []*iam.Rule{rule(nil, "RelationalDatabasesReadOnly", "InstancesFullAccess")},
+			want:  autoresize.PermissionMissing,
+		},
+		{
+			name:  "no rule",
+			rules: nil,
+			want:  autoresize.PermissionMissing,
+		},
+		{
+			name:    "narrower rdb set",
+			rules:   []*iam.Rule{rule(nil, "RelationalDatabasesReadOnly"), rule(nil, "RelationalDatabasesInstancesManager")},
+			want:    autoresize.PermissionUnknown,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rulesResizePermission(tt.rules, projectID)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("rulesResizePermission() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("rulesResizePermission() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
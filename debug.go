@@ -4,14 +4,46 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httputil"
+	"regexp"
 )
 
-type loggingTransport struct{}
+var (
+	// sensitiveHeaders matches the dumped lines of headers carrying
+	// credentials.
+	sensitiveHeaders = regexp.MustCompile(`(?im)^(authorization|proxy-authorization|x-auth-token|cookie|set-cookie):.*$`)
+	// sensitiveFields matches json fields carrying credentials.
+	sensitiveFields = regexp.MustCompile(`"(secret_key|password|token|secret)"(\s*:\s*)"[^"]*"`)
+)
+
+// redact replaces credentials in an http dump.
+func redact(dump []byte) []byte {
+	dump = sensitiveHeaders.ReplaceAll(dump, []byte("$1: [REDACTED]"))
+	return sensitiveFields.ReplaceAll(dump, []byte(`"$1"$2"[REDACTED]"`))
+}
+
+type loggingTransport struct {
+	// redact removes credentials from the logged requests and responses.
+	redact bool
+}
 
 func (s *loggingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	reqBytes, _ := httputil.DumpRequestOut(r, true)
 	resp, err := http.DefaultTransport.RoundTrip(r)
+	if s.redact {
+		reqBytes = redact(reqBytes)
+	}
+	if err != nil {
+		slog.Debug(
+			"http request",
+			slog.String("request", string(reqBytes)),
+			slog.Any("error", err),
+		)
+		return nil, err
+	}
 	respBytes, _ := httputil.DumpResponse(resp, true)
+	if s.redact {
+		respBytes = redact(respBytes)
+	}
 	slog.Debug(
 		"http request",
 		slog.String("request", string(reqBytes)),
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoggingTransportError(t *testing.T) {
+	// a closed server refuses connections
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	for _, redact := range []bool{false, true} {
+		transport := &loggingTransport{redact: redact}
+		req := httptest.NewRequest(http.MethodGet, srv.URL, nil)
+		req.RequestURI = ""
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			t.Fatalf("RoundTrip() succeeded, want an error")
+		}
+		if resp != nil {
+			t.Fatalf("RoundTrip() response = %v, want nil", resp)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchEvaluateSignal requests an immediate check of the instances on
+// SIGALRM, for deployments without the http server. SIGUSR1 and SIGUSR2
+// being taken by the pause, SIGALRM is used instead. Signals received while
+// a check is pending are coalesced.
+func watchEvaluateSignal() <-chan struct{} {
+	evaluate := make(chan struct{}, 1)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGALRM)
+	go func() {
+		for sig := range c {
+			select {
+			case evaluate <- struct{}{}:
+				slog.Debug("evaluation requested", slog.String("signal", sig.String()))
+			default:
+			}
+		}
+	}()
+	return evaluate
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+)
+
+// Exit codes, by class of failure.
+const (
+	exitOK = 0
+	// exitError is a runtime error, such as the api being unreachable.
+	exitError = 1
+	// exitConfig is an invalid configuration, or a failed validation.
+	exitConfig = 2
+	// exitAuth is the api rejecting the credentials.
+	exitAuth = 3
+	// exitVolumeType is an instance volume that cannot be resized.
+	exitVolumeType = 4
+	// exitLimitReached is an instance volume reaching the size limit.
+	exitLimitReached = 5
+	// exitTooManyErrors is an instance failing too many checks in a row.
+	exitTooManyErrors = 6
+)
+
+// exitCodeFor returns the exit code matching the class of err, or fallback
+// if it has none.
+func exitCodeFor(err error, fallback int) int {
+	switch {
+	case errors.Is(err, autoresize.ErrTooManyErrors):
+		return exitTooManyErrors
+	case autoresize.IsAuthError(err):
+		return exitAuth
+	case errors.Is(err, autoresize.ErrUnsupportedVolumeType):
+		return exitVolumeType
+	case errors.Is(err, autoresize.ErrLimitReached):
+		return exitLimitReached
+	case errors.Is(err, autoresize.ErrConfig):
+		return exitConfig
+	}
+	return fallback
+}
+
+// usage prints the command line help, followed by the exit codes.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", flag.CommandLine.Name())
+	flag.PrintDefaults()
+	fmt.Fprintf(out, `
+Exit codes:
+  %d  success
+  %d  runtime error
+  %d  invalid configuration or failed validation
+  %d  invalid api credentials
+  %d  unsupported volume type
+  %d  volume size limit reached
+  %d  too many consecutive failed checks
+
+Signals:
+  SIGINT, SIGTERM  clean shutdown
+  SIGHUP           reload the configuration, reopen the log file
+  SIGUSR1          toggle the pause of the resizes
+  SIGUSR2          resume the resizes
+  SIGALRM          check all the instances immediately (SIGUSR1 being taken by the pause)
+`, exitOK, exitError, exitConfig, exitAuth, exitVolumeType, exitLimitReached, exitTooManyErrors)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+	autoresizepb "github.com/nlm/rdb-autoresize/proto"
+)
+
+// grpcHistorySize is the number of resize records returned by GetStatus.
+const grpcHistorySize = 10
+
+// statusServer implements the grpc StatusService.
+type statusServer struct {
+	autoresizepb.UnimplementedStatusServiceServer
+	controllers []*autoresize.Controller
+}
+
+func (s *statusServer) GetStatus(ctx context.Context, ref *autoresizepb.InstanceRef) (*autoresizepb.StatusResponse, error) {
+	var c *autoresize.Controller
+	switch {
+	case ref.GetInstanceId() != "":
+		for _, candidate := range s.controllers {
+			if candidate.InstanceID() == ref.GetInstanceId() {
+				c = candidate
+			}
+		}
+		if c == nil {
+			return nil, status.Errorf(codes.NotFound, "instance %s is not watched", ref.GetInstanceId())
+		}
+	case len(s.controllers) == 1:
+		c = s.controllers[0]
+	default:
+		return nil, status.Error(codes.InvalidArgument, "instance id is required when several instances are watched")
+	}
+
+	st := c.Status()
+	resp := &autoresizepb.StatusResponse{
+		InstanceId:             st.InstanceID,
+		Region:                 st.Region,
+		CurrentVolumeSizeBytes: st.CurrentVolumeSizeBytes,
+		LastDiskUsagePct:       st.LastDiskUsagePct,
+		LastCheckTime:          timestampOrNil(st.LastCheckTime),
+		LastResizeTime:         timestampOrNil(st.LastResizeTime),
+		ResizeCount:            int64(st.ResizeCount),
+		VolumeSizeLimitBytes:   st.VolumeSizeLimitBytes,
+		Paused:                 st.Paused,
+		LimitReached:           st.LimitReached,
+		CircuitBreakerState:    st.CircuitBreakerState,
+		NextResizeAttempt:      timestampOrNil(st.NextResizeAttempt),
+		ConfigVersion:          st.ConfigVersion,
+	}
+	history := c.ResizeHistory()
+	for _, record := range history[max(len(history)-grpcHistorySize, 0):] {
+		resp.ResizeHistory = append(resp.ResizeHistory, &autoresizepb.ResizeRecord{
+			Time:         timestamppb.New(record.Time),
+			InstanceId:   record.InstanceID,
+			OldSize:      record.OldSize,
+			NewSize:      record.NewSize,
+			UsagePercent: record.UsagePercent,
+			TriggeredBy:  record.TriggeredBy,
+			Error:        record.Error,
+		})
+	}
+	return resp, nil
+}
+
+func timestampOrNil(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// serveGRPC starts the grpc status server in the background.
+func serveGRPC(addr string, controllers []*autoresize.Controller) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := grpc.NewServer()
+	autoresizepb.RegisterStatusServiceServer(server, &statusServer{controllers: controllers})
+	go func() {
+		slog.Info("grpc server listening", slog.String("addr", addr))
+		if err := server.Serve(lis); err != nil {
+			slog.Error("grpc server failed", slog.Any("error", err))
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// readInstanceIDFile returns the instance ids listed in the file at path,
+// separated by commas or whitespace, such as written by a provisioning step.
+// An id may be prefixed by its region, as in fr-par/<id>, see
+// splitInstanceID.
+func readInstanceIDFile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error reading instance id file: %w", autoresize.ErrConfig, err)
+	}
+	ids := strings.FieldsFunc(string(content), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: instance id file %s is empty", autoresize.ErrConfig, path)
+	}
+	return ids, nil
+}
+
+// splitInstanceID splits an instance id optionally prefixed by its region, as
+// in fr-par/<id>. The region is empty when there is no prefix.
+func splitInstanceID(value string) (region string, id string, err error) {
+	region, id, ok := strings.Cut(value, "/")
+	if !ok {
+		return "", value, nil
+	}
+	if _, err := scw.ParseRegion(region); err != nil {
+		return "", "", fmt.Errorf("%w: invalid region of instance %s: %w", autoresize.ErrConfig, id, err)
+	}
+	return region, id, nil
+}
+
+// readRegionFile returns the region written in the file at path.
+func readRegionFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: error reading region file: %w", autoresize.ErrConfig, err)
+	}
+	region := strings.TrimSpace(string(content))
+	if region == "" {
+		return "", fmt.Errorf("%w: region file %s is empty", autoresize.ErrConfig, path)
+	}
+	return region, nil
+}
+
+// rdbRegion returns the region of the instances whose ids have no region
+// prefix: the region of the region file, or SCW_RDB_REGION. It is empty if
+// none is set.
+func rdbRegion() (string, error) {
+	if *flagRegionFile != "" {
+		return readRegionFile(*flagRegionFile)
+	}
+	return Getenv("SCW_RDB_REGION"), nil
+}
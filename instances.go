@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+// listedInstance is the json output of list-instances.
+type listedInstance struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Region     string `json:"region"`
+	VolumeType string `json:"volume_type"`
+	VolumeSize uint64 `json:"volume_size"`
+	Status     string `json:"status"`
+}
+
+// listInstances implements the list-instances subcommand, which prints the
+// rdb instances of a project to help finding the ids to configure. The
+// instances of all regions are listed, unless a region is configured.
+func listInstances(args []string) error {
+	fs := flag.NewFlagSet("list-instances", flag.ExitOnError)
+	output := fs.String("output", "table", "output format, table or json")
+	projectID := fs.String("project-id", os.Getenv("SCW_DEFAULT_PROJECT_ID"), "project to list the instances of, defaults to all accessible projects")
+	fs.Parse(args)
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("invalid output format: %s", *output)
+	}
+
+	client, err := makeClient()
+	if err != nil {
+		return err
+	}
+	rdbApi := rdb.NewAPI(client)
+	regions := rdbApi.Regions()
+	if region, ok := client.GetDefaultRegion(); ok {
+		regions = []scw.Region{region}
+	}
+	req := &rdb.ListInstancesRequest{}
+	if *projectID != "" {
+		req.ProjectID = projectID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *flagQueryTimeout)
+	defer cancel()
+	var instances []listedInstance
+	for _, region := range regions {
+		req.Region = region
+		resp, err := rdbApi.ListInstances(req, scw.WithAllPages(), scw.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("error listing instances in %s: %w", region, err)
+		}
+		for _, instance := range resp.Instances {
+			listed := listedInstance{
+				ID:     instance.ID,
+				Name:   instance.Name,
+				Region: instance.Region.String(),
+				Status: instance.Status.String(),
+			}
+			if instance.Volume != nil {
+				listed.VolumeType = instance.Volume.Type.String()
+				listed.VolumeSize = uint64(instance.Volume.Size)
+			}
+			instances = append(instances, listed)
+		}
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(instances)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tREGION\tVOLUME TYPE\tVOLUME SIZE\tSTATUS")
+	for _, instance := range instances {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			instance.ID,
+			instance.Name,
+			instance.Region,
+			instance.VolumeType,
+			autoresize.HumanSize(instance.VolumeSize),
+			instance.Status,
+		)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+// logFile is a writer appending to a file which can be reopened, so that
+// external tools can rotate it.
+type logFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	lf := &logFile{path: path}
+	if err := lf.Reopen(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.file.Write(p)
+}
+
+// Reopen closes the current file, if any, and opens the file at path again.
+func (lf *logFile) Reopen() error {
+	file, err := os.OpenFile(lf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.file != nil {
+		lf.file.Close()
+	}
+	lf.file = file
+	return nil
+}
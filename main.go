@@ -1,231 +1,1049 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/docker/go-units"
-	"github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+	"github.com/nlm/rdb-autoresize/autoresize"
 	"github.com/scaleway/scaleway-sdk-go/scw"
 )
 
 var (
 	flagTriggerPct      = flag.String("trigger-percentage", GetenvDefault("SCW_RDB_TRIGGER_PERCENTAGE", "90"), "disk resize trigger percentage")
+	flagInstanceIDFile  = flag.String("instance-id-file", GetenvDefault("SCW_RDB_INSTANCE_ID_FILE", ""), "file to read the instance ids from, instead of SCW_RDB_INSTANCE_ID")
+	flagRegionFile      = flag.String("region-file", GetenvDefault("SCW_RDB_REGION_FILE", ""), "file to read the instance region from, instead of SCW_RDB_REGION")
+	flagAlertPct        = flag.String("alert-threshold-pct", GetenvDefault("SCW_RDB_ALERT_THRESHOLD_PCT", ""), "disk usage percentage above which an alert is sent without resizing, defaults to the trigger percentage")
+	flagConfigFile      = flag.String("config", GetenvDefault("SCW_RDB_CONFIG_FILE", ""), "path to a yaml configuration file")
 	flagVolumeSizeLimit = flag.String("volume-size-limit", GetenvDefault("SCW_RDB_VOLUME_SIZE_LIMIT", "0GB"), "target volume size limit")
+	flagMinVolumeSize   = flag.String("min-volume-size", GetenvDefault("SCW_RDB_MIN_VOLUME_SIZE", ""), "minimum size of resize targets, on top of the node type minimum volume size")
+	flagMaxVolumeSize   = flag.String("max-volume-size", GetenvDefault("SCW_RDB_MAX_VOLUME_SIZE", ""), "hard cap of the volume size, on top of the node type maximum volume size")
+	flagLimitPctOfMax   = flag.String("limit-percent-of-max", GetenvDefault("SCW_RDB_LIMIT_PERCENT_OF_MAX", ""), "volume size limit as a percentage of the node type maximum volume size")
+	flagLimitBinary     = flag.Bool("volume-size-limit-binary", false, "parse volume size limits in binary units (1GB = 2^30 bytes), whatever -units")
+	flagUnits           = flag.String("units", GetenvDefault("SCW_RDB_UNITS", autoresize.UnitsDecimal), "units used to parse and display sizes, decimal (GB) or binary (GiB)")
+	flagSizeLimitTiers  = flag.String("size-limit-tiers", GetenvDefault("SCW_RDB_SIZE_LIMIT_TIERS", ""), "comma-separated list of volume size limit tiers")
+	flagLimitWarningPct = flag.String("volume-size-limit-warning-pct", GetenvDefault("SCW_RDB_VOLUME_SIZE_LIMIT_WARNING_PCT", "90"), "percentage of the volume size limit above which a warning is logged, 0 to disable")
+	flagAdaptiveInc     = flag.Bool("adaptive-increment", false, "double the increment on each resize following the previous one within -adaptive-increment-reset")
+	flagIncrementCap    = flag.String("increment-cap", GetenvDefault("SCW_RDB_INCREMENT_CAP", "50GB"), "maximum increment reached with -adaptive-increment")
+	flagAdaptiveReset   = flag.Duration("adaptive-increment-reset", time.Hour, "delay between resizes under which the adaptive increment grows, and usage must stay under the trigger for to reset it")
+	flagTargetFreeSpace = flag.String("target-free-space", GetenvDefault("SCW_RDB_TARGET_FREE_SPACE", "0GB"), "free space to restore on each resize instead of adding the increment, 0 to disable")
+	flagTriggerFree     = flag.String("trigger-free-space", GetenvDefault("SCW_RDB_TRIGGER_FREE_SPACE", "0GB"), "free space under which a resize is triggered, combined with the trigger percentage by -trigger-mode, 0 to disable")
+	flagTriggerMode     = flag.String("trigger-mode", GetenvDefault("SCW_RDB_TRIGGER_MODE", autoresize.TriggerModeOr), "combination of the trigger percentage and free space conditions, or or and")
+	flagMinFreeSpace    = flag.String("min-free-space", GetenvDefault("SCW_RDB_MIN_FREE_SPACE", "0GB"), "minimum free space left by a resize, whatever the increment, 0 to disable")
+	flagMaxResizeDelta  = flag.String("max-resize-delta", GetenvDefault("SCW_RDB_MAX_RESIZE_DELTA", "0GB"), "maximum size added by a single resize, 0 to disable")
+	flagAllowLSSD       = flag.Bool("allow-lssd", false, "[EXPERIMENTAL] also resize local ssd (lssd) volumes")
+	flagEmergencyPct    = flag.String("emergency-threshold", GetenvDefault("SCW_RDB_EMERGENCY_THRESHOLD", "98"), "disk usage percentage above which -emergency-jump-to-limit resizes straight to the size limit")
+	flagEmergencyJump   = flag.Bool("emergency-jump-to-limit", false, "resize straight to the size limit when usage is over the emergency threshold or the disk is full")
+	flagIOPSTriggerPct  = flag.String("iops-trigger-pct", GetenvDefault("SCW_RDB_IOPS_TRIGGER_PCT", "0"), "disk write iops utilization percentage above which a resize is triggered, 0 to disable")
+	flagCPUTriggerPct   = flag.String("cpu-trigger-pct", GetenvDefault("SCW_RDB_CPU_TRIGGER_PCT", "0"), "cpu usage percentage above which, when sustained, a node type upgrade is triggered, 0 to disable")
+	flagCPUNodeType     = flag.String("cpu-upgrade-node-type", GetenvDefault("SCW_RDB_CPU_UPGRADE_NODE_TYPE", ""), "node type to upgrade to on sustained cpu usage, only notified if empty")
+	flagPredictHours    = flag.String("predict-hours", GetenvDefault("SCW_RDB_PREDICT_HOURS", "0"), "resize ahead when usage is predicted to cross the trigger within this many hours, 0 to disable")
+	flagRequireUptime   = flag.String("require-uptime-hours", GetenvDefault("SCW_RDB_REQUIRE_UPTIME_HOURS", "0"), "minimum age of an instance, since its creation, for it to be resized, 0 to disable")
+	flagPreResizeCmd    = flag.String("pre-resize-cmd", GetenvDefault("SCW_RDB_PRE_RESIZE_CMD", ""), "command to run before a resize, a failure aborts the resize")
+	flagPostResizeCmd   = flag.String("post-resize-cmd", GetenvDefault("SCW_RDB_POST_RESIZE_CMD", ""), "command to run after a resize")
+	flagSkipOnBackup    = flag.Bool("skip-resize-on-backup", false, "defer resizes to the next check while a backup of the instance is running")
+	flagSnapshotResize  = flag.Bool("snapshot-before-resize", false, "create a snapshot of the instance before each resize, skipping the resize if it fails")
+	flagSnapshotTimeout = flag.Duration("snapshot-timeout", 30*time.Minute, "maximum wait for the snapshot before a resize to be ready")
+	flagWebhookURL      = flag.String("webhook-url", GetenvDefault("SCW_RDB_WEBHOOK_URL", ""), "url to post event notifications to")
+	flagSlackWebhookURL = flag.String("slack-webhook-url", GetenvDefault("SCW_RDB_SLACK_WEBHOOK_URL", ""), "slack incoming webhook url to send notifications to")
+	flagSNSTopicARN     = flag.String("sns-topic-arn", GetenvDefault("SCW_RDB_SNS_TOPIC_ARN", ""), "aws sns topic to publish event notifications to")
+	flagSMTPHost        = flag.String("smtp-host", GetenvDefault("SCW_RDB_SMTP_HOST", ""), "smtp server to send event notifications by email through")
+	flagSMTPPort        = flag.String("smtp-port", GetenvDefault("SCW_RDB_SMTP_PORT", "25"), "port of the smtp server")
+	flagSMTPFrom        = flag.String("smtp-from", GetenvDefault("SCW_RDB_SMTP_FROM", ""), "sender address of notification emails")
+	flagSMTPTo          = flag.String("smtp-to", GetenvDefault("SCW_RDB_SMTP_TO", ""), "comma-separated recipient addresses of notification emails")
+	flagSMTPTLS         = flag.Bool("smtp-tls", false, "use STARTTLS with the smtp server")
+	flagEventsStdout    = flag.Bool("events-stdout", false, "print event notifications to stdout as cloudevents json")
+	flagHeartbeatURL    = flag.String("heartbeat-url", GetenvDefault("SCW_RDB_HEARTBEAT_URL", ""), "url to ping after each poll, suffixed with /fail on errors")
+	flagAlertOnly       = flag.Bool("alert-only", false, "run every check and notification, but never resize, such as with read-only credentials")
+	flagNotifyStartup   = flag.Bool("notify-startup", false, "send a startup_test notification once the startup checks passed, to verify the notifiers")
+	flagNotifyOnHealthy = flag.Bool("notify-on-healthy", false, "send a notification when usage is back to healthy levels after a resize")
+	flagRecheck         = flag.Bool("recheck-before-resize", false, "check disk usage again right before resizing, and abort if it dropped under the trigger")
+	flagListenAddr      = flag.String("listen-addr", GetenvDefault("SCW_RDB_LISTEN_ADDR", ""), "address of the http server exposing metrics, disabled if empty")
+	flagDebugEndpoints  = flag.Bool("debug-endpoints", false, "serve the raw api responses on /debug/raw-instance and /debug/raw-metrics of the http server, which may expose sensitive metadata")
+	flagGRPCAddr        = flag.String("grpc-addr", GetenvDefault("SCW_RDB_GRPC_ADDR", ""), "address of the grpc status server, disabled if empty")
+	flagMetricsFile     = flag.String("metrics-file", GetenvDefault("SCW_RDB_METRICS_FILE", ""), "file to write metrics to after each check, for the node-exporter textfile collector")
+	flagOTLPEndpoint    = flag.String("otlp-metrics-endpoint", GetenvDefault("SCW_RDB_OTLP_METRICS_ENDPOINT", ""), "url of an otlp grpc collector to export metrics to, disabled if empty")
+	flagPushgatewayAddr = flag.String("pushgateway-addr", GetenvDefault("SCW_RDB_PUSHGATEWAY_ADDR", ""), "url of a prometheus pushgateway to push metrics to, disabled if empty")
+	flagHistoryFile     = flag.String("record-history-file", GetenvDefault("SCW_RDB_RECORD_HISTORY_FILE", ""), "json lines file recording the resize events, to restore the resize history after a restart")
+	flagStatsdAddr      = flag.String("statsd-addr", GetenvDefault("SCW_RDB_STATSD_ADDR", ""), "host:port of a statsd server to send metrics to over udp, disabled if empty")
+	flagStatsdFormat    = flag.String("statsd-format", GetenvDefault("SCW_RDB_STATSD_FORMAT", autoresize.StatsdFormatStatsd), "statsd line format, statsd or dogstatsd (with instance_id and region tags)")
+	flagQueryTimeout    = flag.Duration("query-timeout", 1*time.Minute, "timeout for read operations")
+	flagResizeTimeout   = flag.Duration("resize-timeout", 20*time.Minute, "timeout for resize operations")
+	flagMaxBackoff      = flag.Duration("max-resize-backoff", 2*time.Hour, "maximum delay between resize attempts after failures")
+	flagAlertFailures   = flag.Int("alert-after-failures", 3, "number of consecutive failed checks after which an alert is sent, 0 to disable")
+	flagMaxErrors       = flag.Int("max-consecutive-errors", 0, "number of consecutive failed checks of an instance after which the tool exits, 0 to disable")
+	flagStartupAttempts = flag.Int("startup-attempts", 5, "deprecated, use -backoff-attempts")
+	flagBackoffBase     = flag.Duration("backoff-base", 5*time.Second, "delay before the first retry of a failed operation, doubled after each failure")
+	flagBackoffMax      = flag.Duration("backoff-max", time.Minute, "maximum delay between retries of a failed operation")
+	flagBackoffAttempts = flag.Int("backoff-attempts", 5, "maximum number of attempts of a failed operation")
+	flagRateLimitSleep  = flag.Duration("max-rate-limit-sleep", 5*time.Minute, "maximum wait before retrying a request rejected by the api rate limit")
+	flagInitialDelay    = flag.Duration("initial-delay", 0, "delay before entering the control loop, the first checks of several instances being spread over it")
+	flagStartupGrace    = flag.Duration("startup-grace", 0, "time after startup during which resizes are deferred, usage being still checked")
+	flagUsageWindow     = flag.Duration("usage-window", 0, "range of the disk usage data points to aggregate, 0 to use the most recent point only")
+	flagUsageAggr       = flag.String("usage-aggregation", autoresize.AggregationLast, "aggregation of the disk usage data points over -usage-window: last, max or avg")
+	flagMaxMetricAge    = flag.Duration("max-metric-age", autoresize.DefaultMaxMetricAge, "maximum age of the disk usage data point, older ones fail the check (0 to disable)")
+	flagWorkers         = flag.Int("workers", 0, "number of instances checked concurrently, defaults to the number of instances up to 10")
+	flagResizeRate      = flag.Float64("per-instance-resize-rate", 1, "maximum number of resizes of an instance per check interval, 0 to disable")
+	flagExitOnLimit     = flag.Bool("exit-on-limit", true, "exit when a resize over the volume size limit is needed, instead of notifying it and monitoring on")
+	flagOnce            = flag.Bool("once", false, "run a single check, resizing if needed, then exit")
+	flagValidate        = flag.Bool("validate", false, "validate the configuration against the instance and exit")
+	flagSimulate        = flag.String("simulate", "", "replay the disk usage samples of this csv file instead of monitoring an instance, then exit")
+	flagSimulateSize    = flag.String("simulate-volume-size", "10GB", "initial volume size of the simulated instance")
+	flagUserAgent       = flag.String("user-agent", GetenvDefault("SCW_RDB_USER_AGENT", ""), "override the user agent of http requests")
+	flagLogFile         = flag.String("log-file", "", "file to write logs to, defaults to stderr")
 	flagLogJson         = flag.Bool("log-json", false, "use json format for logging")
+	flagLogLabels       = flag.String("log-labels", "", "comma-separated key=value attributes added to every log line, such as env=prod,team=payments")
 	flagDebug           = flag.Bool("debug", false, "enable debug logging")
+	flagDebugRedact     = flag.Bool("debug-redact", true, "redact credentials from the http requests logged in debug mode, -debug-redact=false to disable")
+	flagEnvPrefix       = flag.String("env-prefix", defaultEnvPrefix, "prefix of the RDB_* environment variables, such as PROD_SCW_ to read PROD_SCW_RDB_INSTANCE_ID")
 )
 
-var (
-	queryTimeout      = 1 * time.Minute
-	diskSizeIncrement = uint64(5 * units.GB)
-	loopInterval      = 5 * time.Minute
-	appVersion        = "dev"
-	userAgent         = "RDBAutoResize/" + appVersion
-)
+// defaultEnvPrefix is the prefix of the RDB_* environment variables.
+const defaultEnvPrefix = "SCW_"
+
+// envPrefix is the -env-prefix flag value. The flag defaults are read from
+// the environment before the flags are parsed, so it is looked up in the
+// arguments beforehand.
+var envPrefix = envPrefixFromArgs(os.Args[1:])
+
+// envPrefixFromArgs returns the value of the -env-prefix flag in args, or
+// the default prefix.
+func envPrefixFromArgs(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "env-prefix" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return defaultEnvPrefix
+}
+
+// Getenv returns the value of the environment variable key. The SCW_ prefix
+// of the SCW_RDB_* variables is replaced with the -env-prefix one.
+func Getenv(key string) string {
+	if name, ok := strings.CutPrefix(key, defaultEnvPrefix+"RDB_"); ok {
+		key = envPrefix + "RDB_" + name
+	}
+	return os.Getenv(key)
+}
 
 func GetenvDefault(key string, defaultValue string) string {
-	value := os.Getenv(key)
+	value := Getenv(key)
 	if value == "" {
 		return defaultValue
 	}
 	return value
 }
 
-func setupLogging() {
+func setupLogging(w io.Writer) error {
+	labels, err := parseLogLabels(*flagLogLabels)
+	if err != nil {
+		return err
+	}
 	logLevel := slog.LevelInfo
 	if *flagDebug {
 		logLevel = slog.LevelDebug
 	}
-	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+	var handler slog.Handler = slog.NewTextHandler(w, &slog.HandlerOptions{Level: logLevel})
 	if *flagLogJson {
-		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: logLevel})
+	}
+	slog.SetDefault(slog.New(handler.WithAttrs(labels)))
+	return nil
+}
+
+// parseLogLabels parses comma-separated key=value pairs into log attributes.
+func parseLogLabels(value string) ([]slog.Attr, error) {
+	var labels []slog.Attr
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid log label '%s', must be key=value", pair)
+		}
+		labels = append(labels, slog.String(strings.TrimSpace(key), strings.TrimSpace(val)))
+	}
+	return labels, nil
+}
+
+// logOutput returns the writer logs should go to. When logging to a file,
+// the file is reopened on SIGHUP to support log rotation.
+func logOutput() (io.Writer, error) {
+	if *flagLogFile == "" {
+		return os.Stderr, nil
+	}
+	lf, err := openLogFile(*flagLogFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening log file: %w", err)
+	}
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		for range c {
+			if err := lf.Reopen(); err != nil {
+				slog.Error("error reopening log file", slog.Any("error", err))
+				continue
+			}
+			slog.Info("log file reopened", slog.String("path", *flagLogFile))
+		}
+	}()
+	return lf, nil
+}
+
+// withOverrides returns a copy of s with the overrides of an instance
+// applied.
+func withOverrides(s *autoresize.Settings, ic instanceConfig) (*autoresize.Settings, error) {
+	o := s.Clone()
+	o.Overrides = nil
+	if ic.TriggerPercentage != 0 {
+		if len(s.Stages) > 0 {
+			return nil, fmt.Errorf("trigger percentage cannot be overridden when stages are configured")
+		}
+		if err := checkTriggerPercent(ic.TriggerPercentage); err != nil {
+			return nil, err
+		}
+		if s.AlertPercent > ic.TriggerPercentage {
+			return nil, fmt.Errorf("alert threshold percentage must be between 0 and the trigger percentage")
+		}
+		if s.EmergencyPercent != 0 && s.EmergencyPercent <= ic.TriggerPercentage {
+			return nil, fmt.Errorf("emergency threshold must be between the trigger percentage and 100")
+		}
+		o.TriggerPercent = ic.TriggerPercentage
 	}
+	if ic.VolumeSizeLimit != "" {
+		limit, err := parseSizeLimit(ic.VolumeSizeLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid volume size limit: %w", err)
+		}
+		if limit == 0 {
+			return nil, fmt.Errorf("limit is ZERO, no resize can happen")
+		}
+		o.SizeLimits = []int64{limit}
+		o.LimitPercentOfMax = 0
+	}
+	if ic.Increment != "" {
+		if len(s.Stages) > 0 {
+			return nil, fmt.Errorf("increment cannot be overridden when stages are configured")
+		}
+		increment, err := parseIncrement(ic.Increment)
+		if err != nil {
+			return nil, err
+		}
+		o.Increment = increment
+	}
+	if ic.Interval != "" {
+		interval, err := parseInterval(ic.Interval)
+		if err != nil {
+			return nil, err
+		}
+		o.Interval = interval
+	}
+	return o, nil
 }
 
-func parseOptions() (float64, int64, error) {
+func parseOptions() (*autoresize.Settings, error) {
+	// size units
+	switch *flagUnits {
+	case autoresize.UnitsDecimal, autoresize.UnitsBinary:
+		// only set once, options are parsed again on reloads
+		if autoresize.Units != *flagUnits {
+			autoresize.Units = *flagUnits
+		}
+	default:
+		return nil, fmt.Errorf("invalid units '%s', must be decimal or binary", *flagUnits)
+	}
+
+	// config file
+	config := &configFile{}
+	if *flagConfigFile != "" {
+		var err error
+		config, err = loadConfigFile(*flagConfigFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// trigger percentage
 	triggerPercent, err := strconv.ParseFloat(*flagTriggerPct, 64)
 	if err != nil {
-		return 0, 0, fmt.Errorf(
+		return nil, fmt.Errorf(
 			"invalid trigger percentage '%s': %w",
 			*flagTriggerPct,
 			err,
 		)
 	}
-	if triggerPercent >= 100 || triggerPercent < 80 {
-		return 0, 0, fmt.Errorf("trigger percent must be between 80 and 100")
+	if config.TriggerPercentage != 0 {
+		triggerPercent = config.TriggerPercentage
+	}
+	if err := checkTriggerPercent(triggerPercent); err != nil {
+		return nil, err
 	}
 
 	// volume size limit
-	volumeSizeLimit, err := units.FromHumanSize(*flagVolumeSizeLimit)
+	volumeSizeLimitStr := *flagVolumeSizeLimit
+	if config.VolumeSizeLimit != "" {
+		volumeSizeLimitStr = config.VolumeSizeLimit
+	}
+	volumeSizeLimit, err := parseSizeLimit(volumeSizeLimitStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid volume size limit: %w", err)
+	}
+
+	// max resize delta
+	maxResizeDelta, err := autoresize.ParseSize(*flagMaxResizeDelta)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max resize delta: %w", err)
+	}
+	if maxResizeDelta < 0 {
+		return nil, fmt.Errorf("max resize delta must be positive")
+	}
+
+	// alert threshold
+	var alertPercent float64
+	if *flagAlertPct != "" {
+		alertPercent, err = strconv.ParseFloat(*flagAlertPct, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert threshold percentage '%s': %w", *flagAlertPct, err)
+		}
+		if alertPercent <= 0 {
+			return nil, fmt.Errorf("alert threshold percentage must be between 0 and the trigger percentage")
+		}
+	}
+
+	// volume size limit warning
+	limitWarnPercent, err := strconv.ParseFloat(*flagLimitWarningPct, 64)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"invalid volume size limit warning percentage '%s': %w",
+			*flagLimitWarningPct,
+			err,
+		)
+	}
+	if limitWarnPercent < 0 || limitWarnPercent > 100 {
+		return nil, fmt.Errorf("volume size limit warning percentage must be between 0 and 100")
+	}
+
+	// emergency jump to limit
+	var emergencyPercent float64
+	if *flagEmergencyJump {
+		emergencyPercent, err = strconv.ParseFloat(*flagEmergencyPct, 64)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"invalid emergency threshold '%s': %w",
+				*flagEmergencyPct,
+				err,
+			)
+		}
+	}
+
+	// increment
+	increment := autoresize.DefaultIncrement
+	if config.Increment != "" {
+		increment, err = parseIncrement(config.Increment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// interval
+	interval := autoresize.DefaultInterval
+	if config.Interval != "" {
+		interval, err = parseInterval(config.Interval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// volume size limit tiers
+	var sizeLimits []int64
+	var limitPercentOfMax float64
+	if *flagLimitPctOfMax != "" {
+		if volumeSizeLimit != 0 || *flagSizeLimitTiers != "" {
+			return nil, fmt.Errorf("limit percent of max is mutually exclusive with other volume size limits")
+		}
+		limitPercentOfMax, err = strconv.ParseFloat(*flagLimitPctOfMax, 64)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"invalid limit percent of max '%s': %w",
+				*flagLimitPctOfMax,
+				err,
+			)
+		}
+		if limitPercentOfMax <= 0 || limitPercentOfMax > 100 {
+			return nil, fmt.Errorf("limit percent of max must be between 0 and 100")
+		}
+	} else if *flagSizeLimitTiers != "" {
+		if volumeSizeLimit != 0 {
+			return nil, fmt.Errorf("volume size limit and size limit tiers are mutually exclusive")
+		}
+		for _, tier := range strings.Split(*flagSizeLimitTiers, ",") {
+			limit, err := parseSizeLimit(strings.TrimSpace(tier))
+			if err != nil {
+				return nil, fmt.Errorf("invalid size limit tier '%s': %w", tier, err)
+			}
+			if limit == 0 {
+				return nil, fmt.Errorf("size limit tier '%s' is ZERO", tier)
+			}
+			sizeLimits = append(sizeLimits, limit)
+		}
+		slices.Sort(sizeLimits)
+	} else {
+		if volumeSizeLimit == 0 {
+			return nil, fmt.Errorf("limit is ZERO, no resize can happen")
+		}
+		sizeLimits = []int64{volumeSizeLimit}
+	}
+
+	// prediction
+	predictHours, err := strconv.ParseFloat(*flagPredictHours, 64)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"invalid predict hours '%s': %w",
+			*flagPredictHours,
+			err,
+		)
+	}
+	if predictHours < 0 {
+		return nil, fmt.Errorf("predict hours must be positive")
+	}
+
+	// required uptime
+	requireUptimeHours, err := strconv.ParseFloat(*flagRequireUptime, 64)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"invalid required uptime hours '%s': %w",
+			*flagRequireUptime,
+			err,
+		)
+	}
+	if requireUptimeHours < 0 {
+		return nil, fmt.Errorf("required uptime hours must be positive")
+	}
+
+	// iops trigger
+	iopsTriggerPercent, err := strconv.ParseFloat(*flagIOPSTriggerPct, 64)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"invalid iops trigger percentage '%s': %w",
+			*flagIOPSTriggerPct,
+			err,
+		)
+	}
+	if iopsTriggerPercent < 0 || iopsTriggerPercent > 100 {
+		return nil, fmt.Errorf("iops trigger percent must be between 0 and 100")
+	}
+
+	// adaptive increment
+	incrementCap, err := autoresize.ParseSize(*flagIncrementCap)
+	if err != nil {
+		return nil, fmt.Errorf("invalid increment cap: %w", err)
+	}
+	if *flagAdaptiveInc && incrementCap <= 0 {
+		return nil, fmt.Errorf("increment cap must be positive")
+	}
+	if *flagAdaptiveInc && *flagAdaptiveReset <= 0 {
+		return nil, fmt.Errorf("adaptive increment reset must be positive")
+	}
+
+	// cpu trigger
+	cpuTriggerPercent, err := strconv.ParseFloat(*flagCPUTriggerPct, 64)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"invalid cpu trigger percentage '%s': %w",
+			*flagCPUTriggerPct,
+			err,
+		)
+	}
+	if cpuTriggerPercent < 0 || cpuTriggerPercent > 100 {
+		return nil, fmt.Errorf("cpu trigger percent must be between 0 and 100")
+	}
+
+	// target free space
+	targetFreeSpace, err := autoresize.ParseSize(*flagTargetFreeSpace)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target free space: %w", err)
+	}
+	if targetFreeSpace < 0 {
+		return nil, fmt.Errorf("target free space must be positive")
+	}
+
+	// min free space
+	minFreeSpace, err := autoresize.ParseSize(*flagMinFreeSpace)
+	if err != nil {
+		return nil, fmt.Errorf("invalid min free space: %w", err)
+	}
+	if minFreeSpace < 0 {
+		return nil, fmt.Errorf("min free space must be positive")
+	}
+
+	// trigger free space
+	triggerFreeSpace, err := autoresize.ParseSize(*flagTriggerFree)
 	if err != nil {
-		return 0, 0, fmt.Errorf("invalid volume size limit: %w", err)
+		return nil, fmt.Errorf("invalid trigger free space: %w", err)
+	}
+	if triggerFreeSpace < 0 {
+		return nil, fmt.Errorf("trigger free space must be positive")
 	}
-	if volumeSizeLimit == 0 {
-		return 0, 0, fmt.Errorf("limit is ZERO, no resize can happen")
+	switch *flagTriggerMode {
+	case autoresize.TriggerModeOr, autoresize.TriggerModeAnd:
+	default:
+		return nil, fmt.Errorf("invalid trigger mode '%s', must be or or and", *flagTriggerMode)
+	}
+
+	// stages
+	var stages []autoresize.Stage
+	if len(config.Stages) > 0 {
+		for _, cs := range config.Stages {
+			if cs.Threshold >= 100 || cs.Threshold < 80 {
+				return nil, fmt.Errorf("stage threshold must be between 80 and 100")
+			}
+			increment, err := autoresize.ParseSize(cs.Increment)
+			if err != nil {
+				return nil, fmt.Errorf("invalid stage increment '%s': %w", cs.Increment, err)
+			}
+			if increment <= 0 {
+				return nil, fmt.Errorf("stage increment must be positive")
+			}
+			stages = append(stages, autoresize.Stage{Threshold: cs.Threshold, Increment: uint64(increment)})
+		}
+		slices.SortFunc(stages, func(a, b autoresize.Stage) int {
+			return cmp.Compare(a.Threshold, b.Threshold)
+		})
+		triggerPercent = stages[0].Threshold
+	}
+
+	// alert threshold under the trigger, as set by the stages
+	if alertPercent > triggerPercent {
+		return nil, fmt.Errorf("alert threshold percentage must be between 0 and the trigger percentage")
+	}
+
+	// emergency threshold over the trigger, as set by the stages
+	if *flagEmergencyJump && (emergencyPercent <= triggerPercent || emergencyPercent > 100) {
+		return nil, fmt.Errorf("emergency threshold must be between the trigger percentage and 100")
 	}
 
-	return triggerPercent, volumeSizeLimit, nil
+	// max volume size
+	var maxVolumeSize int64
+	if *flagMaxVolumeSize != "" {
+		maxVolumeSize, err = parseSizeLimit(*flagMaxVolumeSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max volume size: %w", err)
+		}
+		if maxVolumeSize <= 0 {
+			return nil, fmt.Errorf("max volume size must be positive")
+		}
+	}
+
+	// min volume size
+	var minVolumeSize int64
+	if *flagMinVolumeSize != "" {
+		minVolumeSize, err = parseSizeLimit(*flagMinVolumeSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min volume size: %w", err)
+		}
+		if minVolumeSize < 0 {
+			return nil, fmt.Errorf("min volume size must be positive")
+		}
+		if maxVolumeSize != 0 && minVolumeSize > maxVolumeSize {
+			return nil, fmt.Errorf(
+				"min volume size %s is above the max volume size %s",
+				autoresize.HumanSize(minVolumeSize),
+				autoresize.HumanSize(maxVolumeSize),
+			)
+		}
+	}
+
+	opts := &autoresize.Settings{
+		TriggerPercent:     triggerPercent,
+		Stages:             stages,
+		SizeLimits:         sizeLimits,
+		LimitPercentOfMax:  limitPercentOfMax,
+		MaxVolumeSize:      uint64(maxVolumeSize),
+		MinVolumeSize:      uint64(minVolumeSize),
+		PredictHours:       predictHours,
+		RequireUptime:      time.Duration(requireUptimeHours * float64(time.Hour)),
+		IOPSTriggerPercent: iopsTriggerPercent,
+		TargetFreeSpace:    uint64(targetFreeSpace),
+		MinFreeSpace:       uint64(minFreeSpace),
+		TriggerFreeSpace:   uint64(triggerFreeSpace),
+		TriggerMode:        *flagTriggerMode,
+		MaxResizeDelta:     uint64(maxResizeDelta),
+		LimitWarnPercent:   limitWarnPercent,
+		AlertPercent:       alertPercent,
+		EmergencyPercent:   emergencyPercent,
+		AdaptiveIncrement:  *flagAdaptiveInc,
+		IncrementCap:       uint64(incrementCap),
+		AdaptiveReset:      *flagAdaptiveReset,
+		CPUTriggerPercent:  cpuTriggerPercent,
+		CPUUpgradeNodeType: *flagCPUNodeType,
+		Increment:          increment,
+		Interval:           interval,
+		AllowLSSD:          *flagAllowLSSD,
+	}
+
+	// per-instance overrides
+	if len(config.Instances) > 0 {
+		opts.Overrides = make(map[string]*autoresize.Settings, len(config.Instances))
+		for id, ic := range config.Instances {
+			o, err := withOverrides(opts, ic)
+			if err != nil {
+				return nil, fmt.Errorf("invalid settings for instance %s: %w", id, err)
+			}
+			opts.Overrides[id] = o
+		}
+	}
+
+	// size limits under the max volume size
+	if maxVolumeSize != 0 {
+		settings := []*autoresize.Settings{opts}
+		for _, o := range opts.Overrides {
+			settings = append(settings, o)
+		}
+		for _, o := range settings {
+			if len(o.SizeLimits) > 0 && o.SizeLimits[len(o.SizeLimits)-1] > maxVolumeSize {
+				return nil, fmt.Errorf(
+					"volume size limit %s is above the max volume size %s",
+					autoresize.HumanSize(o.SizeLimits[len(o.SizeLimits)-1]),
+					autoresize.HumanSize(maxVolumeSize),
+				)
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+func checkTriggerPercent(triggerPercent float64) error {
+	if math.IsNaN(triggerPercent) || math.IsInf(triggerPercent, 0) {
+		return fmt.Errorf("trigger percent %v is not a number", triggerPercent)
+	}
+	if triggerPercent >= 100 || triggerPercent < 80 {
+		return fmt.Errorf("trigger percent %.1f is out of allowed range [80, 100)", triggerPercent)
+	}
+	return nil
+}
+
+// parseSizeLimit parses a volume size limit, in binary units with
+// -volume-size-limit-binary and in the configured units otherwise.
+func parseSizeLimit(value string) (int64, error) {
+	if *flagLimitBinary {
+		return units.RAMInBytes(value)
+	}
+	return autoresize.ParseSize(value)
+}
+
+func parseIncrement(value string) (uint64, error) {
+	size, err := autoresize.ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid increment '%s': %w", value, err)
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("increment must be positive")
+	}
+	return uint64(size), nil
 }
 
-func makeAutoResizer() (*AutoResizer, error) {
+// backoffPolicy returns the retry policy configured by the -backoff flags.
+// The deprecated -startup-attempts overrides the attempts when set.
+func backoffPolicy() autoresize.Backoff {
+	b := autoresize.Backoff{
+		Base:     *flagBackoffBase,
+		Max:      *flagBackoffMax,
+		Attempts: *flagBackoffAttempts,
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "startup-attempts" {
+			b.Attempts = *flagStartupAttempts
+		}
+	})
+	return b.WithDefaults()
+}
+
+func parseInterval(value string) (time.Duration, error) {
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval '%s': %w", value, err)
+	}
+	if interval < time.Minute {
+		return 0, fmt.Errorf("interval must be at least 1m")
+	}
+	return interval, nil
+}
+
+// instanceIDs returns the ids of the instances to watch, from the instance id
+// file or the comma-separated SCW_RDB_INSTANCE_ID. They may be prefixed by
+// their region, see splitInstanceID.
+func instanceIDs() ([]string, error) {
+	if *flagInstanceIDFile != "" {
+		return readInstanceIDFile(*flagInstanceIDFile)
+	}
+	var ids []string
+	for _, id := range strings.Split(Getenv("SCW_RDB_INSTANCE_ID"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("%w: no instance configured, set SCW_RDB_INSTANCE_ID or SCW_RDB_INSTANCE_ID_FILE", autoresize.ErrConfig)
+	}
+	return ids, nil
+}
+
+// userAgent returns the user agent of the http requests, the -user-agent
+// override or the default one.
+func userAgent() string {
+	if *flagUserAgent != "" {
+		return *flagUserAgent
+	}
+	return autoresize.DefaultUserAgent()
+}
+
+// makeClient creates the scaleway api client. Its credentials are those of
+// the environment or of the scaleway config profile, and its default region
+// is the region of rdbRegion, or the region of the scaleway config profile.
+func makeClient() (*scw.Client, error) {
+	profile := activeProfile()
+	accessKey, secretKey, err := apiCredentials(profile)
+	if err != nil {
+		return nil, err
+	}
 	var options = []scw.ClientOption{
-		scw.WithAuth(os.Getenv("SCW_ACCESS_KEY"), os.Getenv("SCW_SECRET_KEY")),
-		scw.WithUserAgent(userAgent),
+		scw.WithAuth(accessKey, secretKey),
+		scw.WithUserAgent(userAgent()),
 	}
+	var transport http.RoundTripper = http.DefaultTransport
 	if *flagDebug {
-		options = append(options, scw.WithHTTPClient(&http.Client{
-			Transport: &loggingTransport{},
-		}))
+		transport = &loggingTransport{redact: *flagDebugRedact}
+	}
+	options = append(options, scw.WithHTTPClient(&http.Client{
+		Transport: &rateLimitTransport{
+			next:     transport,
+			maxSleep: *flagRateLimitSleep,
+			backoff:  backoffPolicy(),
+		},
+	}))
+	if projectID := os.Getenv("SCW_DEFAULT_PROJECT_ID"); projectID != "" {
+		options = append(options, scw.WithDefaultProjectID(projectID))
+	}
+	region, err := rdbRegion()
+	if err != nil {
+		return nil, err
+	}
+	if region != "" {
+		options = append(options, scw.WithDefaultRegion(scw.Region(region)))
+	} else if profile != nil && profile.DefaultRegion != nil {
+		options = append(options, scw.WithDefaultRegion(scw.Region(*profile.DefaultRegion)))
 	}
 	client, err := scw.NewClient(options...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating api client: %w", err)
 	}
-	return NewAutoResizer(client, os.Getenv("SCW_RDB_REGION"), os.Getenv("SCW_RDB_INSTANCE_ID")), nil
+	return client, nil
+}
+
+// makeAutoResizers creates the resizers of the watched instances, and returns
+// whether the credentials are allowed to resize them.
+func makeAutoResizers() ([]*autoresize.AutoResizer, autoresize.Permission, error) {
+	ids, err := instanceIDs()
+	if err != nil {
+		return nil, autoresize.PermissionUnknown, err
+	}
+	client, err := makeClient()
+	if err != nil {
+		return nil, autoresize.PermissionUnknown, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *flagQueryTimeout)
+	defer cancel()
+	permission, err := checkCredentials(ctx, client)
+	if err != nil {
+		return nil, autoresize.PermissionUnknown, err
+	}
+	rdbARs := make([]*autoresize.AutoResizer, 0, len(ids))
+	for _, value := range ids {
+		region, id, err := splitInstanceID(value)
+		if err != nil {
+			return nil, autoresize.PermissionUnknown, err
+		}
+		if region == "" {
+			defaultRegion, ok := client.GetDefaultRegion()
+			if !ok {
+				return nil, autoresize.PermissionUnknown, fmt.Errorf("%w: no region configured, set SCW_RDB_REGION, a default region in the scaleway config profile, or prefix the instance id with its region", autoresize.ErrConfig)
+			}
+			region = string(defaultRegion)
+		}
+		rdbAR := autoresize.NewAutoResizer(client, region, id)
+		rdbAR.SetMaxMetricAge(*flagMaxMetricAge)
+		if err := rdbAR.SetUsageAggregation(*flagUsageWindow, *flagUsageAggr); err != nil {
+			return nil, autoresize.PermissionUnknown, fmt.Errorf("%w: %w", autoresize.ErrConfig, err)
+		}
+		rdbARs = append(rdbARs, rdbAR)
+	}
+	return rdbARs, permission, nil
+}
+
+// activeProfile returns the active scaleway config profile, or nil if there
+// is none.
+func activeProfile() *scw.Profile {
+	config, err := scw.LoadConfig()
+	if err != nil {
+		slog.Debug("no scaleway config loaded", slog.Any("error", err))
+		return nil
+	}
+	profile, err := config.GetActiveProfile()
+	if err != nil {
+		slog.Warn("error loading scaleway config profile", slog.Any("error", err))
+		return nil
+	}
+	return profile
+}
+
+// profileRegion returns the default region of the active scaleway config
+// profile, or an empty string if there is none.
+func profileRegion() string {
+	profile := activeProfile()
+	if profile == nil || profile.DefaultRegion == nil {
+		return ""
+	}
+	return *profile.DefaultRegion
+}
+
+func makeNotifier() (autoresize.Notifier, error) {
+	var notifier autoresize.MultiNotifier
+	if *flagWebhookURL != "" {
+		notifier = append(notifier, autoresize.NewWebhookNotifier(*flagWebhookURL, userAgent()))
+	}
+	if *flagSlackWebhookURL != "" {
+		notifier = append(notifier, autoresize.NewSlackNotifier(*flagSlackWebhookURL))
+	}
+	if *flagSMTPHost != "" {
+		if *flagSMTPFrom == "" || *flagSMTPTo == "" {
+			return nil, fmt.Errorf("smtp sender and recipients must be set")
+		}
+		notifier = append(notifier, autoresize.NewEmailNotifier(*flagSMTPHost, *flagSMTPPort, *flagSMTPFrom, *flagSMTPTo, *flagSMTPTLS))
+	}
+	if *flagSNSTopicARN != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), *flagQueryTimeout)
+		defer cancel()
+		snsNotifier, err := autoresize.NewSNSNotifier(ctx, *flagSNSTopicARN)
+		if err != nil {
+			return nil, err
+		}
+		notifier = append(notifier, snsNotifier)
+	}
+	if *flagEventsStdout {
+		notifier = append(notifier, autoresize.NewCloudEventsNotifier(os.Stdout))
+	}
+	return notifier, nil
 }
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
-	setupLogging()
+	w, err := logOutput()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfig)
+	}
+	if err := setupLogging(w); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitConfig)
+	}
+
+	// Subcommands
+	if flag.Arg(0) == "list-instances" {
+		if err := listInstances(flag.Args()[1:]); err != nil {
+			slog.Error("error listing instances", slog.Any("error", err))
+			os.Exit(exitCodeFor(err, exitError))
+		}
+		os.Exit(exitOK)
+	}
+	if flag.Arg(0) == "migrate-volume-type" {
+		if err := migrateVolumeType(flag.Args()[1:]); err != nil {
+			slog.Error("error migrating volume type", slog.Any("error", err))
+			os.Exit(exitCodeFor(err, exitError))
+		}
+		os.Exit(exitOK)
+	}
 
 	// Parse options
-	triggerPercent, volumeSizeLimit, err := parseOptions()
+	opts, err := parseOptions()
 	if err != nil {
 		slog.Error("error parsing options", slog.Any("error", err))
-		os.Exit(1)
+		os.Exit(exitConfig)
+	}
+	stages := make([]string, 0, len(opts.Stages))
+	for _, st := range opts.Stages {
+		stages = append(stages, fmt.Sprintf("%g%%:+%s", st.Threshold, autoresize.HumanSize(st.Increment)))
 	}
 	slog.Info(
 		"rdb autoresizer started",
-		slog.String("volume_size_limit", units.HumanSize(float64(volumeSizeLimit))),
-		slog.Float64("trigger_percentage", triggerPercent),
-		slog.String("version", appVersion),
+		slog.Any("volume_size_limits", opts.DescribeSizeLimits()),
+		slog.Float64("trigger_percentage", opts.TriggerPercent),
+		slog.String("increment", autoresize.HumanSize(opts.Increment)),
+		slog.Duration("interval", opts.Interval),
+		slog.Any("stages", stages),
+		slog.String("units", autoresize.Units),
+		slog.String("version", autoresize.Version),
 	)
+	for _, limit := range opts.SizeLimits {
+		slog.Warn(
+			"volume size limit resolved, check the units are the expected ones",
+			slog.Int64("volume_size_limit_bytes", limit),
+			slog.String("decimal", units.HumanSize(float64(limit))),
+			slog.String("binary", units.BytesSize(float64(limit))),
+			slog.Bool("volume_size_limit_binary", *flagLimitBinary),
+		)
+	}
+	for id, o := range opts.Overrides {
+		slog.Info(
+			"instance settings overridden",
+			append([]any{slog.String("instance_id", id)}, autoresize.DiffSettings(opts, o)...)...,
+		)
+	}
 
-	// Creating API client and Helper
-	rdbAR, err := makeAutoResizer()
-	if err != nil {
-		slog.Error("error creating api client", slog.Any("error", err))
-		os.Exit(1)
+	if *flagAllowLSSD {
+		slog.Warn("[EXPERIMENTAL] resizing local ssd (lssd) volumes is allowed, this may cause downtime depending on the scaleway plan")
 	}
 
-	// Check that instance exists, is compatible and that queries are working
-	err = func() error {
-		ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
-		defer cancel()
-		instance, err := rdbAR.GetInstance(ctx)
+	if *flagSimulate != "" {
+		volumeSize, err := autoresize.ParseSize(*flagSimulateSize)
 		if err != nil {
-			return err
+			slog.Error("error parsing simulated volume size", slog.Any("error", err))
+			os.Exit(exitConfig)
 		}
-		slog.Info(
-			"rdb instance found",
-			slog.Group("instance",
-				slog.String("id", instance.ID),
-				slog.String("name", instance.Name),
-				slog.String("region", instance.Region.String()),
-				slog.Group("volume",
-					slog.String("type", instance.Volume.Type.String()),
-					slog.String("size", units.HumanSize(float64(instance.Volume.Size))),
-				),
-			),
-		)
-		if instance.Volume.Type != rdb.VolumeTypeBssd {
-			return fmt.Errorf("unsupported volume type: %s", instance.Volume.Type)
+		if err := autoresize.Simulate(*flagSimulate, uint64(volumeSize), opts); err != nil {
+			slog.Error("error during simulation", slog.Any("error", err))
+			os.Exit(exitCodeFor(err, exitError))
 		}
-		if int64(instance.Volume.Size) >= volumeSizeLimit {
-			return fmt.Errorf("current volume size is larger than the defined limit")
-		}
-		return nil
-	}()
-	if err != nil {
-		slog.Error("error during instance pre-checks", slog.Any("error", err))
-		os.Exit(1)
+		os.Exit(exitOK)
 	}
 
-	// Control Loop
-	slog.Debug("entering control loop", slog.Duration("interval", loopInterval))
-	t := time.NewTicker(loopInterval)
-	for ; ; <-t.C {
-		// Check current usage
-		v, err := func() (float64, error) {
-			ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
-			defer cancel()
-			return rdbAR.GetDiskUsagePercent(ctx)
-		}()
-		if err != nil {
-			slog.Error("error getting current disk usage", slog.Any("error", err))
-			continue
+	// Creating API client and Helpers
+	rdbARs, permission, err := makeAutoResizers()
+	if err != nil {
+		slog.Error("error creating api client", slog.Any("error", err))
+		os.Exit(exitCodeFor(err, exitError))
+	}
+	for id := range opts.Overrides {
+		if !slices.ContainsFunc(rdbARs, func(rdbAR *autoresize.AutoResizer) bool { return rdbAR.InstanceID() == id }) {
+			slog.Warn("settings overridden for an instance that is not watched", slog.String("instance_id", id))
 		}
-		slog.Info("current disk usage", slog.Float64("percent_used", v))
-
-		// Take action
-		if v > triggerPercent {
-			slog.Warn(
-				"disk space is over max usage target",
-				slog.Float64("percent_target", triggerPercent),
-				slog.Float64("percent_used", v),
-			)
-
-			// Check instance information
-			instance, err := func() (*rdb.Instance, error) {
-				ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
-				defer cancel()
-				return rdbAR.GetInstance(ctx)
-			}()
-			if err != nil {
-				slog.Error("error getting instance details", slog.Any("error", err))
-				continue
-			}
-			slog.Debug(
-				"current volume size",
-				slog.String("size", units.HumanSize(float64(instance.Volume.Size))),
-			)
-			if instance.Volume.Type != rdb.VolumeTypeBssd {
-				slog.Error(
-					"volume type is non-resizeable",
-					slog.String("volume_type", instance.Volume.Type.String()),
-				)
-				os.Exit(1)
+	}
+	if *flagValidate {
+		success := permission != autoresize.PermissionMissing || *flagAlertOnly
+		if !success {
+			slog.Error("validation check failed", slog.String("check", "resize_permission"), slog.String("error", "the api credentials are not allowed to resize instances"))
+		}
+		for _, rdbAR := range rdbARs {
+			ctx, cancel := context.WithTimeout(context.Background(), *flagQueryTimeout)
+			if !autoresize.Validate(ctx, rdbAR, opts.ForInstance(rdbAR.InstanceID())) {
+				success = false
 			}
+			cancel()
+		}
+		if !success {
+			os.Exit(exitConfig)
+		}
+		os.Exit(exitOK)
+	}
+	notifier, err := makeNotifier()
+	if err != nil {
+		slog.Error("error creating notifier", slog.Any("error", err))
+		os.Exit(exitConfig)
+	}
+	if *flagResizeRate < 0 {
+		slog.Error("per-instance resize rate must be positive")
+		os.Exit(exitConfig)
+	}
 
-			// Check size limit
-			targetSize := uint64(instance.Volume.Size) + diskSizeIncrement
-			if targetSize > uint64(volumeSizeLimit) {
-				slog.Error(
-					"new volume size is over limit",
-					slog.String("target_size", units.HumanSize(float64(targetSize))),
-					slog.String("limit_size", units.HumanSize(float64(volumeSizeLimit))),
-				)
-				os.Exit(1)
-			}
+	// Shutdown on termination signals
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-			// Do the resize
-			err = func() error {
-				ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
-				defer cancel()
-				slog.Warn(
-					"triggering resize",
-					slog.String("current_size", units.HumanSize(float64(instance.Volume.Size))),
-					slog.String("target_size", units.HumanSize(float64(targetSize))),
-				)
-				_, err := rdbAR.ResizeVolume(ctx, targetSize)
-				return err
+	// Pause and resume on user signals
+	pause := &autoresize.Pause{}
+	handlePauseSignals(pause)
 
-			}()
-			if err != nil {
-				slog.Error(
-					"unable to resize instance",
-					slog.Any("error", err),
-				)
-				continue
+	err = autoresize.Run(ctx, autoresize.Config{
+		Instances:            rdbARs,
+		Settings:             opts,
+		Notifier:             notifier,
+		QueryTimeout:         *flagQueryTimeout,
+		ResizeTimeout:        *flagResizeTimeout,
+		MaxResizeBackoff:     *flagMaxBackoff,
+		AlertAfterFailures:   *flagAlertFailures,
+		MaxConsecutiveErrors: *flagMaxErrors,
+		Backoff:              backoffPolicy(),
+		Workers:              *flagWorkers,
+		ResizeRate:           *flagResizeRate,
+		NotifyOnHealthy:      *flagNotifyOnHealthy,
+		RecheckBeforeResize:  *flagRecheck,
+		CollectUsageBytes:    *flagListenAddr != "" || *flagPushgatewayAddr != "" || *flagMetricsFile != "" || *flagStatsdAddr != "",
+		ExitOnLimit:          *flagExitOnLimit,
+		Once:                 *flagOnce,
+		InitialDelay:         *flagInitialDelay,
+		StartupGrace:         *flagStartupGrace,
+		PreResizeCmd:         *flagPreResizeCmd,
+		PostResizeCmd:        *flagPostResizeCmd,
+		AlertOnly:            *flagAlertOnly,
+		Pause:                pause,
+		UserAgent:            userAgent(),
+		NotifyStartupTest:    *flagNotifyStartup,
+		ResizePermission:     permission,
+		SkipResizeOnBackup:   *flagSkipOnBackup,
+		SnapshotBeforeResize: *flagSnapshotResize,
+		SnapshotTimeout:      *flagSnapshotTimeout,
+		HeartbeatURL:         *flagHeartbeatURL,
+		PushgatewayAddr:      *flagPushgatewayAddr,
+		MetricsFile:          *flagMetricsFile,
+		HistoryFile:          *flagHistoryFile,
+		StatsdAddr:           *flagStatsdAddr,
+		StatsdFormat:         *flagStatsdFormat,
+		OTLPMetricsEndpoint:  *flagOTLPEndpoint,
+		// Reload configuration on SIGHUP
+		Reloads: watchReloads(),
+		// Check immediately on SIGALRM
+		Evaluate: watchEvaluateSignal(),
+		Started: func(controllers []*autoresize.Controller) error {
+			if *flagListenAddr != "" {
+				serveHTTP(ctx, *flagListenAddr, controllers, *flagDebugEndpoints)
 			}
-		}
+			if *flagGRPCAddr != "" {
+				if err := serveGRPC(*flagGRPCAddr, controllers); err != nil {
+					return fmt.Errorf("%w: error starting grpc server: %w", autoresize.ErrConfig, err)
+				}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		slog.Error("rdb autoresizer stopped", slog.Any("error", err))
+		stop()
+		os.Exit(exitCodeFor(err, exitError))
 	}
 }
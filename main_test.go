@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// resetFlags replaces flag.CommandLine by a flag set holding the flags of
+// the program set back to their default value, then parses args.
+func resetFlags(t *testing.T, args ...string) {
+	t.Helper()
+	commandLine := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = commandLine })
+	fs := flag.NewFlagSet(commandLine.Name(), flag.ContinueOnError)
+	commandLine.VisitAll(func(f *flag.Flag) {
+		// leave out the flags of the testing package
+		if strings.HasPrefix(f.Name, "test.") {
+			return
+		}
+		if err := f.Value.Set(f.DefValue); err != nil {
+			t.Fatalf("error resetting flag %s: %v", f.Name, err)
+		}
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	flag.CommandLine = fs
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("error parsing flags %v: %v", args, err)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantTrigger float64
+		wantLimits  []int64
+		wantErr     string
+	}{
+		{
+			name:        "valid",
+			args:        []string{"-trigger-percentage", "90", "-volume-size-limit", "100GB"},
+			wantTrigger: 90,
+			wantLimits:  []int64{100_000_000_000},
+		},
+		{
+			name:        "trigger at 80",
+			args:        []string{"-trigger-percentage", "80", "-volume-size-limit", "100GB"},
+			wantTrigger: 80,
+			wantLimits:  []int64{100_000_000_000},
+		},
+		{
+			name:    "trigger at 79.9",
+			args:    []string{"-trigger-percentage", "79.9", "-volume-size-limit", "100GB"},
+			wantErr: "trigger percent 79.9 is out of allowed range [80, 100)",
+		},
+		{
+			name:    "trigger at 100",
+			args:    []string{"-trigger-percentage", "100", "-volume-size-limit", "100GB"},
+			wantErr: "trigger percent 100.0 is out of allowed range [80, 100)",
+		},
+		{
+			name:    "trigger not a number",
+			args:    []string{"-trigger-percentage", "abc", "-volume-size-limit", "100GB"},
+			wantErr: `invalid trigger percentage 'abc': strconv.ParseFloat: parsing "abc": invalid syntax`,
+		},
+		{
+			name:    "limit at 0GB",
+			args:    []string{"-trigger-percentage", "90", "-volume-size-limit", "0GB"},
+			wantErr: "limit is ZERO, no resize can happen",
+		},
+		{
+			name:    "malformed limit",
+			args:    []string{"-trigger-percentage", "90", "-volume-size-limit", "abc"},
+			wantErr: "invalid volume size limit: invalid size: 'abc'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetFlags(t, tt.args...)
+			opts, err := parseOptions()
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("parseOptions() succeeded, want error %q", tt.wantErr)
+				}
+				if err.Error() != tt.wantErr {
+					t.Fatalf("parseOptions() error = %q, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOptions() error = %v", err)
+			}
+			if opts.TriggerPercent != tt.wantTrigger {
+				t.Errorf("TriggerPercent = %v, want %v", opts.TriggerPercent, tt.wantTrigger)
+			}
+			if !slices.Equal(opts.SizeLimits, tt.wantLimits) {
+				t.Errorf("SizeLimits = %v, want %v", opts.SizeLimits, tt.wantLimits)
+			}
+		})
+	}
+}
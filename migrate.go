@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+)
+
+// migrateVolumeType implements the migrate-volume-type subcommand, which
+// converts the volume of an instance to a resizeable type, and waits for the
+// migration to complete.
+func migrateVolumeType(args []string) error {
+	fs := flag.NewFlagSet("migrate-volume-type", flag.ExitOnError)
+	instanceID := fs.String("instance-id", Getenv("SCW_RDB_INSTANCE_ID"), "id of the instance to migrate")
+	volumeType := fs.String("volume-type", rdb.VolumeTypeBssd.String(), "volume type to migrate to")
+	dryRun := fs.Bool("dry-run", false, "show the migration without doing it")
+	fs.Parse(args)
+	if *instanceID == "" || strings.Contains(*instanceID, ",") {
+		return fmt.Errorf("%w: a single instance id is required", autoresize.ErrConfig)
+	}
+	target := rdb.VolumeType(*volumeType)
+
+	client, err := makeClient()
+	if err != nil {
+		return err
+	}
+	region, ok := client.GetDefaultRegion()
+	if !ok {
+		return fmt.Errorf("%w: no region configured, set SCW_RDB_REGION or a default region in the scaleway config profile", autoresize.ErrConfig)
+	}
+	rdbAR := autoresize.NewAutoResizer(client, string(region), *instanceID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *flagQueryTimeout)
+	defer cancel()
+	instance, err := rdbAR.GetInstance(ctx)
+	if err != nil {
+		return err
+	}
+	logger := slog.With(
+		slog.String("instance_id", instance.ID),
+		slog.String("node_type", instance.NodeType),
+		slog.String("volume_type", instance.Volume.Type.String()),
+		slog.String("target_volume_type", target.String()),
+	)
+	if instance.Volume.Type == target {
+		logger.Info("volume already has the target type, nothing to do")
+		return nil
+	}
+	supported, err := rdbAR.SupportsVolumeType(ctx, instance, target)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fmt.Errorf("%w: node type %s does not support migrating to %s", autoresize.ErrUnsupportedVolumeType, instance.NodeType, target)
+	}
+	if instance.Status != rdb.InstanceStatusReady {
+		return fmt.Errorf("instance is not in a ready state: %s", instance.Status)
+	}
+	if *dryRun {
+		logger.Info(
+			"dry run, the volume type would be migrated with an instance upgrade",
+			slog.String("volume_size", autoresize.HumanSize(instance.Volume.Size)),
+		)
+		return nil
+	}
+
+	logger.Warn("migrating volume type")
+	ctx, cancel = context.WithTimeout(context.Background(), *flagResizeTimeout)
+	defer cancel()
+	if _, err := rdbAR.MigrateVolumeType(ctx, target); err != nil {
+		return fmt.Errorf("error migrating volume type: %w", err)
+	}
+	instance, err = rdbAR.WaitForInstance(ctx, *flagResizeTimeout)
+	if err != nil {
+		return fmt.Errorf("error waiting for the migration to complete: %w", err)
+	}
+	if instance.Status != rdb.InstanceStatusReady {
+		return fmt.Errorf("instance is in %s state after migration", instance.Status)
+	}
+	logger.Info("volume type migrated", slog.String("status", instance.Status.String()))
+	return nil
+}
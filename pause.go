@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+)
+
+// handlePauseSignals toggles the pause on SIGUSR1, and resumes on SIGUSR2.
+func handlePauseSignals(pause *autoresize.Pause) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range c {
+			paused := sig == syscall.SIGUSR1 && !pause.Paused()
+			if pause.Set(paused) == paused {
+				continue
+			}
+			if paused {
+				slog.Warn("resizing paused", slog.String("signal", sig.String()))
+			} else {
+				slog.Info("resizing resumed", slog.String("signal", sig.String()))
+			}
+		}
+	}()
+}
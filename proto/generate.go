@@ -0,0 +1,4 @@
+// Package autoresizepb holds the grpc api of the autoresizer.
+package autoresizepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative autoresize.proto
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+)
+
+// rateLimitTransport retries the requests rejected by the api rate limit
+// (HTTP 429), up to the backoff attempts, after waiting for the delay of
+// their Retry-After header, or of the backoff without one, capped to
+// maxSleep. Waits end with the request context.
+type rateLimitTransport struct {
+	next     http.RoundTripper
+	maxSleep time.Duration
+	backoff  autoresize.Backoff
+}
+
+func (t *rateLimitTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(r)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+		if attempt >= t.backoff.Attempts {
+			return resp, nil
+		}
+		// the body cannot be sent again
+		if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+			return resp, nil
+		}
+		delay := retryAfter(resp.Header.Get("Retry-After"), t.backoff.Delay(attempt), t.maxSleep)
+		resp.Body.Close()
+		slog.Warn(
+			"api rate limit reached, waiting before retrying",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Duration("delay", delay),
+		)
+		if err := t.backoff.Sleep(r.Context(), delay); err != nil {
+			return nil, err
+		}
+		if r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = r.Clone(r.Context())
+			r.Body = body
+		}
+	}
+}
+
+// retryAfter returns the delay of a Retry-After header value, in seconds or
+// as an http date, or defaultDelay without a usable one, capped to maxSleep.
+func retryAfter(value string, defaultDelay, maxSleep time.Duration) time.Duration {
+	delay := defaultDelay
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = time.Until(date)
+	}
+	return min(max(delay, 0), maxSleep)
+}
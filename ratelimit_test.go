@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+)
+
+// roundTripFunc is an http.RoundTripper calling itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRateLimitTransport(t *testing.T) {
+	const maxSleep = 2 * time.Second
+	tests := []struct {
+		name       string
+		next       func(*http.Request) (*http.Response, error)
+		wantCalls  int
+		wantSleeps int
+		wantErr    bool
+	}{
+		{
+			name: "always rate limited",
+			next: func(r *http.Request) (*http.Response, error) {
+				rec := httptest.NewRecorder()
+				rec.Header().Set("Retry-After", "3600")
+				rec.WriteHeader(http.StatusTooManyRequests)
+				return rec.Result(), nil
+			},
+			wantCalls:  3,
+			wantSleeps: 2,
+		},
+		{
+			name: "always failing",
+			next: func(r *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			var sleeps []time.Duration
+			transport := &rateLimitTransport{
+				next: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+					calls++
+					return tt.next(r)
+				}),
+				maxSleep: maxSleep,
+				backoff: autoresize.Backoff{
+					Attempts: 3,
+					After: func(d time.Duration) <-chan time.Time {
+						sleeps = append(sleeps, d)
+						ch := make(chan time.Time, 1)
+						ch <- time.Now()
+						return ch
+					},
+				},
+			}
+			req := httptest.NewRequest(http.MethodGet, "https://api.scaleway.com/rdb/v1/regions/fr-par/instances", nil)
+			resp, err := transport.RoundTrip(req)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("RoundTrip() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && resp.StatusCode != http.StatusTooManyRequests {
+				t.Fatalf("RoundTrip() status = %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("got %d calls, want %d", calls, tt.wantCalls)
+			}
+			if len(sleeps) != tt.wantSleeps {
+				t.Fatalf("got %d sleeps, want %d", len(sleeps), tt.wantSleeps)
+			}
+			for _, d := range sleeps {
+				if d > maxSleep {
+					t.Fatalf("slept %s, over the maximum %s", d, maxSleep)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+)
+
+// watchReloads parses the options again on SIGHUP, and sends the new
+// settings on the returned channel. Invalid configurations are logged and
+// ignored. Settings that are only read at startup are reported as requiring
+// a restart.
+func watchReloads() <-chan *autoresize.Settings {
+	reloads := make(chan *autoresize.Settings)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	region := profileRegion()
+	go func() {
+		for range c {
+			opts, err := parseOptions()
+			if err != nil {
+				slog.Error("error reloading configuration, keeping the current one", slog.Any("error", err))
+				continue
+			}
+			if Getenv("SCW_RDB_REGION") == "" && profileRegion() != region {
+				slog.Warn("the region of the scaleway config profile changed, a restart is required to apply it")
+			}
+			reloads <- opts
+		}
+	}()
+	return reloads
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveHTTP starts the http server exposing metrics, the controllers status
+// and the resize history on addr, and running checks on demand. The status
+// is a single object when watching one instance, and a list otherwise. The
+// debug endpoints, returning raw api responses, are only served with debug.
+// The checks run on demand are bound to ctx, not to their request, so that a
+// client going away does not interrupt a resize.
+func serveHTTP(ctx context.Context, addr string, controllers []*autoresize.Controller, debug bool) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if len(controllers) == 1 {
+			writeJSON(w, controllers[0].Status())
+			return
+		}
+		statuses := make([]autoresize.Status, 0, len(controllers))
+		for _, c := range controllers {
+			statuses = append(statuses, c.Status())
+		}
+		writeJSON(w, statuses)
+	})
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var history []autoresize.ResizeRecord
+		for _, c := range controllers {
+			history = append(history, c.ResizeHistory()...)
+		}
+		slices.SortStableFunc(history, func(a, b autoresize.ResizeRecord) int {
+			return a.Time.Compare(b.Time)
+		})
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil || n < 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			history = history[max(len(history)-n, 0):]
+		}
+		if history == nil {
+			history = []autoresize.ResizeRecord{}
+		}
+		writeJSON(w, history)
+	})
+	mux.HandleFunc("/check", checkHandler(ctx, controllers))
+	if debug {
+		mux.HandleFunc("/debug/raw-instance", func(w http.ResponseWriter, r *http.Request) {
+			serveRaw(w, r, controllers, func(c *autoresize.Controller) (json.RawMessage, error) {
+				return c.RawInstance(r.Context())
+			})
+		})
+		mux.HandleFunc("/debug/raw-metrics", func(w http.ResponseWriter, r *http.Request) {
+			serveRaw(w, r, controllers, func(c *autoresize.Controller) (json.RawMessage, error) {
+				return c.RawMetrics(r.Context(), r.URL.Query().Get("metric_name"))
+			})
+		})
+	}
+	go func() {
+		slog.Info("http server listening", slog.String("addr", addr))
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("http server failed", slog.Any("error", err))
+		}
+	}()
+}
+
+// checkHandler runs a check of an instance on demand, bound to ctx. The
+// instance is given by the instance_id parameter, which is optional when
+// watching a single instance.
+func checkHandler(ctx context.Context, controllers []*autoresize.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		c := findController(controllers, r.URL.Query().Get("instance_id"))
+		if c == nil {
+			http.Error(w, "unknown instance, set instance_id", http.StatusNotFound)
+			return
+		}
+		diskPct, resized, err := func() (float64, bool, error) {
+			ctx, cancel := context.WithTimeout(ctx, *flagResizeTimeout)
+			defer cancel()
+			return c.CheckNow(ctx)
+		}()
+		if err != nil {
+			slog.Error("error running check on demand", slog.String("instance_id", c.InstanceID()), slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, checkResponse{
+			InstanceID: c.InstanceID(),
+			DiskPct:    diskPct,
+			Resized:    resized,
+			NewSize:    c.Status().CurrentVolumeSizeBytes,
+		})
+	}
+}
+
+// checkResponse is the response of the /check endpoint.
+type checkResponse struct {
+	InstanceID string  `json:"instance_id"`
+	DiskPct    float64 `json:"disk_pct"`
+	Resized    bool    `json:"resized"`
+	NewSize    uint64  `json:"new_size"`
+}
+
+// findController returns the controller of the instance id, or the only
+// controller when id is empty, nil if there is none.
+func findController(controllers []*autoresize.Controller, id string) *autoresize.Controller {
+	if id == "" {
+		if len(controllers) == 1 {
+			return controllers[0]
+		}
+		return nil
+	}
+	for _, c := range controllers {
+		if c.InstanceID() == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// serveRaw writes the raw api response returned by get for the instance
+// selected as for /check.
+func serveRaw(w http.ResponseWriter, r *http.Request, controllers []*autoresize.Controller, get func(*autoresize.Controller) (json.RawMessage, error)) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	c := findController(controllers, r.URL.Query().Get("instance_id"))
+	if c == nil {
+		http.Error(w, "unknown instance, set instance_id", http.StatusNotFound)
+		return
+	}
+	raw, err := get(c)
+	if err != nil {
+		slog.Error("error querying the api for a debug endpoint", slog.String("instance_id", c.InstanceID()), slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(raw); err != nil {
+		slog.Error("error writing http response", slog.Any("error", err))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("error writing http response", slog.Any("error", err))
+	}
+}
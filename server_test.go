@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlm/rdb-autoresize/autoresize"
+	rdb "github.com/scaleway/scaleway-sdk-go/api/rdb/v1"
+	"github.com/scaleway/scaleway-sdk-go/scw"
+)
+
+const testInstanceID = "11111111-1111-1111-1111-111111111111"
+
+// newTestRDB starts an http server mimicking the rdb endpoints used by a
+// check of a ready instance with a 50GB bssd volume at 95% usage, and
+// returns an AutoResizer pointed at it.
+func newTestRDB(t *testing.T) *autoresize.AutoResizer {
+	t.Helper()
+	instance := rdb.Instance{
+		ID:       testInstanceID,
+		Name:     "test",
+		Region:   scw.RegionFrPar,
+		Status:   rdb.InstanceStatusReady,
+		Engine:   "PostgreSQL-15",
+		NodeType: "db-dev-s",
+		Volume: &rdb.Volume{
+			Type: rdb.VolumeTypeBssd,
+			Size: 50 * scw.GB,
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/rdb/v1/regions/"+scw.RegionFrPar.String()+"/instances/"+testInstanceID)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && path == "":
+			_ = json.NewEncoder(w).Encode(instance)
+		case r.Method == http.MethodGet && path == "/metrics":
+			_ = json.NewEncoder(w).Encode(rdb.InstanceMetrics{Timeseries: []*scw.TimeSeries{{
+				Name:   "disk_usage_percent",
+				Points: []*scw.TimeSeriesPoint{{Timestamp: time.Now(), Value: 95}},
+			}}})
+		case r.Method == http.MethodPost && path == "/upgrade":
+			var req rdb.UpgradeInstanceRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.VolumeSize == nil {
+				http.Error(w, "volume size expected", http.StatusBadRequest)
+				return
+			}
+			instance.Volume.Size = scw.Size(*req.VolumeSize)
+			_ = json.NewEncoder(w).Encode(instance)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client, err := scw.NewClient(
+		scw.WithAPIURL(srv.URL),
+		scw.WithAuth("SCWXXXXXXXXXXXXXXXXX", "11111111-1111-1111-1111-111111111111"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return autoresize.NewAutoResizer(client, scw.RegionFrPar.String(), testInstanceID)
+}
+
+func TestCheckHandlerResize(t *testing.T) {
+	ctx := context.Background()
+	errStarted := errors.New("started")
+	rec := httptest.NewRecorder()
+	err := autoresize.Run(ctx, autoresize.Config{
+		Instances: []*autoresize.AutoResizer{newTestRDB(t)},
+		Settings: &autoresize.Settings{
+			TriggerPercent: 90,
+			SizeLimits:     []int64{100_000_000_000},
+			Increment:      10_000_000_000,
+			Interval:       time.Minute,
+		},
+		Started: func(controllers []*autoresize.Controller) error {
+			req := httptest.NewRequest(http.MethodPost, "/check", nil)
+			checkHandler(ctx, controllers)(rec, req)
+			return errStarted
+		},
+	})
+	if !errors.Is(err, errStarted) {
+		t.Fatalf("Run() error = %v, want %v", err, errStarted)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/check status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var resp checkResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Resized {
+		t.Fatalf("/check resized = false, want true")
+	}
+	if resp.NewSize != 60_000_000_000 {
+		t.Fatalf("/check new_size = %d, want %d", resp.NewSize, uint64(60_000_000_000))
+	}
+}